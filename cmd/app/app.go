@@ -6,18 +6,19 @@ import (
 	"net/http"
 
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
 	"github.com/spf13/cobra"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientv1 "k8s.io/client-go/kubernetes/typed/core/v1"
-	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	"github.com/diagridio/dapr-cert-manager/cmd/app/options"
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
 	"github.com/diagridio/dapr-cert-manager/pkg/controller"
 	"github.com/diagridio/dapr-cert-manager/pkg/trustanchor"
 )
@@ -40,12 +41,9 @@ func NewCommand() *cobra.Command {
 				return err
 			}
 
-			scheme := runtime.NewScheme()
-			if err := corev1.AddToScheme(scheme); err != nil {
-				return fmt.Errorf("error adding corev1 to scheme: %w", err)
-			}
-			if err := cmapi.AddToScheme(scheme); err != nil {
-				return fmt.Errorf("error adding cert-manager scheme: %w", err)
+			scheme, err := newScheme()
+			if err != nil {
+				return err
 			}
 
 			cl, err := kubernetes.NewForConfig(opts.RestConfig)
@@ -58,21 +56,30 @@ func NewCommand() *cobra.Command {
 			eventBroadcaster.StartLogging(func(format string, args ...any) { mlog.V(3).Info(fmt.Sprintf(format, args...)) })
 			eventBroadcaster.StartRecordingToSink(&clientv1.EventSinkImpl{Interface: cl.CoreV1().Events("")})
 
+			// Namespaces selected by label are not known ahead of time, so the
+			// cache must be cluster wide.
+			cacheNamespaces := opts.DaprNamespaces
+			if opts.DaprNamespaceLabelSelector != nil {
+				cacheNamespaces = nil
+			}
+
 			mgr, err := ctrl.NewManager(opts.RestConfig, ctrl.Options{
 				Scheme:                        scheme,
 				EventBroadcaster:              eventBroadcaster,
 				LeaderElection:                true,
-				LeaderElectionNamespace:       opts.DaprNamespace,
+				LeaderElectionNamespace:       opts.LeaderElectionNamespace,
 				LeaderElectionID:              "dapr-cert-manager",
 				LeaderElectionReleaseOnCancel: true,
 				ReadinessEndpointName:         "/readyz",
 				HealthProbeBindAddress:        fmt.Sprintf(":%d", opts.ReadyzPort),
 				Metrics:                       server.Options{BindAddress: fmt.Sprintf(":%d", opts.MetricsPort)},
 				Logger:                        mlog,
-				NewCache: func(config *rest.Config, o cache.Options) (cache.Cache, error) {
-					o.DefaultNamespaces = map[string]cache.Config{opts.DaprNamespace: {}}
-					return cache.New(config, o)
-				},
+				WebhookServer:                 webhook.NewServer(webhook.Options{Port: opts.WebhookPort, CertDir: opts.WebhookCertDir}),
+				NewCache: controller.NewCache(controller.CacheOptions{
+					Namespaces:     cacheNamespaces,
+					SecretNames:    opts.SecretNames,
+					SecretSelector: opts.SecretLabelSelector,
+				}),
 				LeaderElectionResourceLock: "leases",
 			})
 			if err != nil {
@@ -89,24 +96,124 @@ func NewCommand() *cobra.Command {
 
 			ctx := ctrl.SetupSignalHandler()
 			var taSource trustanchor.Interface
-			if len(opts.TrustAnchorFilePath) > 0 {
+			if len(opts.TrustAnchorFilePaths) > 0 {
 				taSource = trustanchor.New(trustanchor.Options{
-					Log:             opts.Logr,
-					TrustBundlePath: opts.TrustAnchorFilePath,
+					Log:              opts.Logr,
+					TrustBundlePaths: opts.TrustAnchorFilePaths,
+				})
+			}
+			if ref := opts.TrustAnchorObject; ref != nil {
+				taSource = trustanchor.NewObject(trustanchor.ObjectOptions{
+					Log:       opts.Logr,
+					Client:    cl,
+					Kind:      ref.Kind,
+					Namespace: ref.Namespace,
+					Name:      ref.Name,
+					Key:       ref.Key,
 				})
+			}
+			if taSource != nil {
 				if err := mgr.Add(taSource); err != nil {
 					return err
 				}
+				// Not ready while the trust anchors fail to reload.
+				if err := mgr.AddReadyzCheck("trust_anchor", taSource.Ready); err != nil {
+					return err
+				}
+			}
+
+			nsTASources := make(map[string]trustanchor.Interface)
+			for namespace, path := range opts.NamespaceTrustAnchorFilePaths {
+				nsTASources[namespace] = trustanchor.New(trustanchor.Options{
+					Log:              opts.Logr.WithValues("namespace", namespace),
+					TrustBundlePaths: []string{path},
+				})
+				if err := mgr.Add(nsTASources[namespace]); err != nil {
+					return err
+				}
+				if err := mgr.AddReadyzCheck("trust_anchor_"+namespace, nsTASources[namespace].Ready); err != nil {
+					return err
+				}
 			}
 
-			if err := controller.AddTrustBundle(mgr, controller.Options{
-				Log:                            opts.Logr,
-				DaprNamespace:                  opts.DaprNamespace,
-				TrustBundleCertificateName:     opts.TrustBundleCertificateName,
-				TrustAnchor:                    taSource,
-			}); err != nil {
+			ctrlOpts := controller.Options{
+				Log:                         opts.Logr,
+				DaprNamespaces:              opts.DaprNamespaces,
+				DaprNamespaceSelector:       opts.DaprNamespaceLabelSelector,
+				TrustBundleCertificateName:  opts.TrustBundleCertificateName,
+				TrustAnchor:                 taSource,
+				NamespaceTrustAnchors:       nsTASources,
+				PruneExpiredTrustAnchors:    opts.PruneExpiredTrustAnchors,
+				TrustAnchorPruneGracePeriod: opts.TrustAnchorPruneGracePeriod,
+				ReplaceTrustAnchors:         opts.ReplaceTrustAnchors,
+				RootRotationSoakPeriod:      opts.RootRotationSoakPeriod,
+				JWTSigningCertificateName:   opts.JWTSigningCertificateName,
+				JWKSPruneGracePeriod:        opts.JWKSPruneGracePeriod,
+				JWTKeyID:                    opts.JWTKeyID,
+				HistoryLimit:                opts.HistoryLimit,
+				Provision: controller.ProvisionOptions{
+					Enabled: opts.ProvisionCertificate,
+					IssuerRef: cmmeta.ObjectReference{
+						Name:  opts.ProvisionIssuerName,
+						Kind:  opts.ProvisionIssuerKind,
+						Group: opts.ProvisionIssuerGroup,
+					},
+					Duration:            opts.ProvisionDuration,
+					RenewBefore:         opts.ProvisionRenewBefore,
+					PrivateKeyAlgorithm: cmapi.PrivateKeyAlgorithm(opts.ProvisionPrivateKeyAlgorithm),
+					PrivateKeySize:      opts.ProvisionPrivateKeySize,
+				},
+				Bootstrap: controller.BootstrapOptions{
+					Enabled:     opts.BootstrapTrustBundle,
+					Labels:      opts.BootstrapLabels,
+					HelmAdopt:   opts.BootstrapHelmAdopt,
+					HelmRelease: opts.BootstrapHelmRelease,
+				},
+				Truststores: controller.TruststoreOptions{
+					PKCS12Key:          opts.TruststorePKCS12Key,
+					PKCS12Profile:      opts.TruststorePKCS12Profile,
+					JKSKey:             opts.TruststoreJKSKey,
+					PasswordSecretName: opts.TruststorePasswordSecretName,
+					PasswordSecretKey:  opts.TruststorePasswordSecretKey,
+				},
+				CertificateBindingsEnabled: opts.CertificateBindingsEnabled,
+				DryRun:                     opts.DryRun,
+			}
+			// Fail on start, rather than on every reconcile, if a Secret which the
+			// controller reads is not cached.
+			if err := controller.CheckSecretNames(ctx, mgr.GetAPIReader(), ctrlOpts, opts.SecretNames); err != nil {
 				return err
 			}
+			if err := controller.AddTrustBundle(mgr, ctrlOpts); err != nil {
+				return err
+			}
+
+			if opts.DistributionNamespaceLabelSelector != nil {
+				if err := controller.AddDistribution(mgr, controller.DistributionOptions{
+					Log:               opts.Logr,
+					NamespaceSelector: opts.DistributionNamespaceLabelSelector,
+					ConfigMapName:     opts.DistributionConfigMapName,
+					SourceNamespace:   opts.DistributionSourceNamespace,
+					DryRun:            opts.DryRun,
+				}); err != nil {
+					return err
+				}
+			}
+
+			// The webhook server is only started once a webhook is registered.
+			if opts.WebhookPort > 0 {
+				if err := controller.AddWebhook(mgr, controller.WebhookOptions{
+					Log:              opts.Logr,
+					Warn:             opts.WebhookMode == "warn",
+					AllowedUsernames: opts.WebhookAllowedUsernames,
+					TrustBundle:      ctrlOpts,
+				}); err != nil {
+					return err
+				}
+				if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+					return err
+				}
+			}
 
 			// Start all runnables and controller
 			return mgr.Start(ctx)
@@ -115,5 +222,25 @@ func NewCommand() *cobra.Command {
 
 	opts = opts.Prepare(cmd)
 
+	cmd.AddCommand(newPlanCommand())
+	cmd.AddCommand(newStatusCommand())
+	cmd.AddCommand(newRenderCommand())
+	cmd.AddCommand(newRollbackCommand())
+
 	return cmd
 }
+
+// newScheme returns the scheme of all resources used by dapr-cert-manager.
+func newScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("error adding corev1 to scheme: %w", err)
+	}
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("error adding cert-manager scheme: %w", err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, fmt.Errorf("error adding dapr-cert-manager scheme: %w", err)
+	}
+	return scheme, nil
+}
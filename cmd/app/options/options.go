@@ -4,16 +4,22 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
 	cliflag "k8s.io/component-base/cli/flag"
 	"k8s.io/klog/v2"
 	"k8s.io/klog/v2/klogr"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/trustanchor"
 )
 
 // Options is a struct to hold options for dapr-cert-manager.
@@ -21,6 +27,10 @@ type Options struct {
 	logLevel        string
 	kubeConfigFlags *genericclioptions.ConfigFlags
 
+	// offline is true for commands which never connect to a cluster, so have
+	// no Kubernetes flags or RestConfig.
+	offline bool
+
 	// ReadyzPort is the TCP port used to expose the readiness probe on 0.0.0.0
 	// on the path `/readyz`.
 	ReadyzPort int
@@ -36,18 +46,239 @@ type Options struct {
 	// API.
 	RestConfig *rest.Config
 
-	// DaprNamespace is the namespace where Dapr is installed.
-	DaprNamespace string
+	// DaprNamespaces are the namespaces where Dapr is installed.
+	DaprNamespaces []string
+
+	// DaprNamespaceSelector is an optional label selector string which selects
+	// additional namespaces where Dapr is installed.
+	DaprNamespaceSelector string
+
+	// DaprNamespaceLabelSelector is the parsed DaprNamespaceSelector. Nil if
+	// DaprNamespaceSelector is empty.
+	DaprNamespaceLabelSelector labels.Selector
+
+	// SecretNames are the names of the Secrets in each dapr namespace which
+	// are cached and watched by the controller: the source cert-manager
+	// Secrets and the target dapr Secrets. dapr-trust-bundle, the truststore
+	// password Secret, and the cert-manager Secret of the provisioned
+	// Certificate are always included.
+	SecretNames []string
+
+	// SecretSelector is an optional label selector string which further
+	// restricts the Secrets cached by the controller.
+	SecretSelector string
+
+	// SecretLabelSelector is the parsed SecretSelector. Nil if SecretSelector
+	// is empty.
+	SecretLabelSelector labels.Selector
+
+	// DistributionNamespaceSelector is an optional label selector string which
+	// selects the namespaces the trust anchors are distributed to as a
+	// ConfigMap.
+	DistributionNamespaceSelector string
+
+	// DistributionNamespaceLabelSelector is the parsed
+	// DistributionNamespaceSelector. Nil if DistributionNamespaceSelector is
+	// empty.
+	DistributionNamespaceLabelSelector labels.Selector
+
+	// DistributionConfigMapName is the name of the ConfigMap the trust anchors
+	// are distributed to.
+	DistributionConfigMapName string
+
+	// DistributionSourceNamespace is the dapr namespace whose trust anchors
+	// are distributed. Defaults to the first DaprNamespaces.
+	DistributionSourceNamespace string
+
+	// LeaderElectionNamespace is the namespace the leader election Lease is
+	// created in. Defaults to the first DaprNamespaces.
+	LeaderElectionNamespace string
 
 	// TrustBundleCertificateName is the name of the cert-manager Certificate
 	// which signs and manages the dapr trust bundle.
 	TrustBundleCertificateName string
 
-	// TrustAnchorFilePath is the name of the file which contains the trust
-	// anchor for all 3 root CAs.
+	// ProvisionCertificate creates the TrustBundleCertificateName cert-manager
+	// Certificate in each dapr namespace if it does not exist.
+	ProvisionCertificate bool
+
+	// ProvisionIssuerName, ProvisionIssuerKind and ProvisionIssuerGroup
+	// reference the cert-manager issuer which signs provisioned Certificates.
+	ProvisionIssuerName  string
+	ProvisionIssuerKind  string
+	ProvisionIssuerGroup string
+
+	// ProvisionDuration and ProvisionRenewBefore are the duration and renew
+	// before of provisioned Certificates.
+	ProvisionDuration    time.Duration
+	ProvisionRenewBefore time.Duration
+
+	// ProvisionPrivateKeyAlgorithm and ProvisionPrivateKeySize are the private
+	// key of provisioned Certificates.
+	ProvisionPrivateKeyAlgorithm string
+	ProvisionPrivateKeySize      int
+
+	// JWTSigningCertificateName is the name of the cert-manager Certificate
+	// whose private key is the dapr Sentry JWT signing key.
+	JWTSigningCertificateName string
+
+	// JWKSPruneGracePeriod is the duration after a key stopped being the JWT
+	// signing key before it is pruned from the JWKS.
+	JWKSPruneGracePeriod time.Duration
+
+	// JWTKeyID is the optional fixed key ID dapr Sentry signs JWTs with.
+	JWTKeyID string
+
+	// HistoryLimit is the number of previous revisions of the issuer and trust
+	// bundle of each dapr Secret to keep for rollbacks.
+	HistoryLimit int
+
+	// TruststorePKCS12Key is the optional key of the dapr trust-bundle Secret
+	// to write the trust bundle to as a PKCS#12 truststore.
+	TruststorePKCS12Key string
+
+	// TruststorePKCS12Profile is the profile of the PKCS#12 truststore.
+	TruststorePKCS12Profile string
+
+	// TruststoreJKSKey is the optional key of the dapr trust-bundle Secret to
+	// write the trust bundle to as a JKS truststore.
+	TruststoreJKSKey string
+
+	// TruststorePasswordSecret is a reference to a Secret key in each dapr
+	// namespace which contains the truststore password, in the form
+	// `<name>:<key>`.
+	TruststorePasswordSecret string
+
+	// TruststorePasswordSecretName and TruststorePasswordSecretKey are the
+	// parsed TruststorePasswordSecret.
+	TruststorePasswordSecretName string
+	TruststorePasswordSecretKey  string
+
+	// TrustAnchorFilePaths are the names of the files, or directories of
+	// files, which contain the trust anchor for all 3 root CAs. All trust
+	// anchors are merged into a single bundle.
 	// If empty, the trust anchor will be sourced from the cert-manager
 	// Certificate.
-	TrustAnchorFilePath string
+	TrustAnchorFilePaths []string
+
+	// TrustAnchorConfigMap is an optional reference to a ConfigMap key which
+	// contains the trust anchor, in the form `<namespace>/<name>:<key>`.
+	TrustAnchorConfigMap string
+
+	// TrustAnchorSecret is an optional reference to a Secret key which
+	// contains the trust anchor, in the form `<namespace>/<name>:<key>`.
+	TrustAnchorSecret string
+
+	// TrustAnchorObject is the parsed TrustAnchorConfigMap or
+	// TrustAnchorSecret. Nil if neither are set.
+	TrustAnchorObject *TrustAnchorObjectRef
+
+	// NamespaceTrustAnchorFilePaths optionally overrides TrustAnchorFilePaths
+	// for the dapr namespace of the map key. The path may be a directory.
+	NamespaceTrustAnchorFilePaths map[string]string
+
+	// PruneExpiredTrustAnchors enables removing expired trust anchors from the
+	// dapr trust bundle.
+	PruneExpiredTrustAnchors bool
+
+	// TrustAnchorPruneGracePeriod is the duration after a trust anchor has
+	// expired before it is pruned from the dapr trust bundle.
+	TrustAnchorPruneGracePeriod time.Duration
+
+	// ReplaceTrustAnchors sets the dapr trust bundle to exactly the trust
+	// anchors of the trust anchor source, rather than appending to it.
+	ReplaceTrustAnchors bool
+
+	// RootRotationSoakPeriod enables orchestrating root CA rotations, gating
+	// each phase of the rotation on the soak period.
+	RootRotationSoakPeriod time.Duration
+
+	// CertificateBindingsEnabled enables reconciling DaprCertificateBinding
+	// resources in the dapr namespace.
+	CertificateBindingsEnabled bool
+
+	// WebhookPort is the port the validating webhook protecting the dapr
+	// trust bundle Secret is served on. The webhook is disabled if zero.
+	WebhookPort int
+
+	// WebhookCertDir is the directory containing the `tls.crt` and `tls.key`
+	// of the webhook server.
+	WebhookCertDir string
+
+	// WebhookMode is either `deny`, to reject destructive edits of the dapr
+	// trust bundle Secret, or `warn` to allow them with a warning.
+	WebhookMode string
+
+	// WebhookAllowedUsernames are the users whose edits of the dapr trust
+	// bundle Secret are never validated by the webhook.
+	WebhookAllowedUsernames []string
+
+	// BootstrapTrustBundle creates the dapr Secrets with the issuer and trust
+	// anchors if they do not exist.
+	BootstrapTrustBundle bool
+
+	// BootstrapHelmAdopt marks the bootstrapped dapr Secrets as owned by the
+	// BootstrapHelmRelease Helm release, so that installing dapr adopts them.
+	BootstrapHelmAdopt bool
+
+	// BootstrapHelmRelease is the name of the Helm release dapr is installed
+	// with. Only used if BootstrapHelmAdopt is true.
+	BootstrapHelmRelease string
+
+	// BootstrapLabels are the labels of the bootstrapped dapr Secrets required
+	// to match SecretLabelSelector.
+	BootstrapLabels map[string]string
+
+	// DryRun logs the changes which would be made to the dapr Secrets rather
+	// than writing them.
+	DryRun bool
+
+	// PlanOutput is the output format of the plan command, either `text` or
+	// `json`.
+	PlanOutput string
+
+	// StatusOutput is the output format of the status command, either
+	// `table`, `json` or `yaml`.
+	StatusOutput string
+
+	// RenderSourceSecret is the path to a cert-manager Secret manifest which
+	// the render command renders the dapr trust bundle Secret from.
+	RenderSourceSecret string
+
+	// RenderIssuerCertFile, RenderIssuerKeyFile and RenderCAFile are paths to
+	// PEM files used by the render command in place of RenderSourceSecret.
+	RenderIssuerCertFile string
+	RenderIssuerKeyFile  string
+	RenderCAFile         string
+
+	// RenderCurrentSecret is the optional path to the current dapr trust
+	// bundle Secret manifest, which the render command merges with.
+	RenderCurrentSecret string
+
+	// RenderOutput is the output format of the render command, either `yaml`
+	// or `json`.
+	RenderOutput string
+
+	// RenderNamespace is the dapr namespace of the Secret rendered from PEM
+	// files.
+	RenderNamespace string
+
+	// RollbackSecretName is the name of the dapr certificate Secret the
+	// rollback command restores.
+	RollbackSecretName string
+
+	// RollbackRevision is the revision the rollback command restores. If
+	// zero, the saved revisions are listed instead.
+	RollbackRevision int
+}
+
+// TrustAnchorObjectRef is a reference to a key of a ConfigMap or Secret which
+// contains the trust anchor.
+type TrustAnchorObjectRef struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Key       string
 }
 
 // New constructs a new Options.
@@ -57,7 +288,44 @@ func New() *Options {
 
 // Prepare adds Options flags to the CLI command.
 func (o *Options) Prepare(cmd *cobra.Command) *Options {
-	o.addFlags(cmd)
+	o.addFlags(cmd, nil)
+	return o
+}
+
+// PreparePlan adds Options flags, as well as the plan flags, to the plan CLI
+// command.
+func (o *Options) PreparePlan(cmd *cobra.Command) *Options {
+	o.addFlags(cmd, func(nfs *cliflag.NamedFlagSets) {
+		o.addPlanFlags(nfs.FlagSet("Plan"))
+	})
+	return o
+}
+
+// PrepareStatus adds Options flags, as well as the status flags, to the
+// status CLI command.
+func (o *Options) PrepareStatus(cmd *cobra.Command) *Options {
+	o.addFlags(cmd, func(nfs *cliflag.NamedFlagSets) {
+		o.addStatusFlags(nfs.FlagSet("Status"))
+	})
+	return o
+}
+
+// PrepareRender adds Options flags, as well as the render flags, to the
+// render CLI command. The render command never connects to a cluster.
+func (o *Options) PrepareRender(cmd *cobra.Command) *Options {
+	o.offline = true
+	o.addFlags(cmd, func(nfs *cliflag.NamedFlagSets) {
+		o.addRenderFlags(nfs.FlagSet("Render"))
+	})
+	return o
+}
+
+// PrepareRollback adds Options flags, as well as the rollback flags, to the
+// rollback CLI command.
+func (o *Options) PrepareRollback(cmd *cobra.Command) *Options {
+	o.addFlags(cmd, func(nfs *cliflag.NamedFlagSets) {
+		o.addRollbackFlags(nfs.FlagSet("Rollback"))
+	})
 	return o
 }
 
@@ -69,35 +337,308 @@ func (o *Options) Complete() error {
 	flag.Set("v", o.logLevel)
 	o.Logr = log.WithName("dapr-cert-manager")
 
+	if o.offline {
+		return o.completeRender()
+	}
+
 	var err error
 	o.RestConfig, err = o.kubeConfigFlags.ToRESTConfig()
 	if err != nil {
 		return fmt.Errorf("failed to build kubernetes rest config: %s", err)
 	}
 
-	if len(o.DaprNamespace) == 0 {
-		return fmt.Errorf("--dapr-namespace must be set")
+	if len(o.DaprNamespaceSelector) > 0 {
+		o.DaprNamespaceLabelSelector, err = labels.Parse(o.DaprNamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("failed to parse --dapr-namespace-selector %q: %w", o.DaprNamespaceSelector, err)
+		}
+		log.Info("managing dapr namespaces matching selector", "selector", o.DaprNamespaceSelector)
+	}
+
+	if len(o.SecretSelector) > 0 {
+		o.SecretLabelSelector, err = labels.Parse(o.SecretSelector)
+		if err != nil {
+			return fmt.Errorf("failed to parse --secret-selector %q: %w", o.SecretSelector, err)
+		}
+		log.Info("only caching Secrets matching selector", "selector", o.SecretSelector)
+	}
+
+	if len(o.DaprNamespaces) == 0 && o.DaprNamespaceLabelSelector == nil {
+		return fmt.Errorf("--dapr-namespace or --dapr-namespace-selector must be set")
+	}
+
+	if len(o.LeaderElectionNamespace) == 0 {
+		if len(o.DaprNamespaces) == 0 {
+			return fmt.Errorf("--leader-election-namespace must be set if --dapr-namespace is not set")
+		}
+		o.LeaderElectionNamespace = o.DaprNamespaces[0]
+	}
+
+	if len(o.DistributionNamespaceSelector) > 0 {
+		o.DistributionNamespaceLabelSelector, err = labels.Parse(o.DistributionNamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("failed to parse --trust-anchor-distribution-namespace-selector %q: %w", o.DistributionNamespaceSelector, err)
+		}
+		if len(o.DistributionSourceNamespace) == 0 {
+			if len(o.DaprNamespaces) == 0 {
+				return fmt.Errorf("--trust-anchor-distribution-source-namespace must be set if --dapr-namespace is not set")
+			}
+			o.DistributionSourceNamespace = o.DaprNamespaces[0]
+		}
+		log.Info("distributing trust anchors to namespaces matching selector", "selector", o.DistributionNamespaceSelector,
+			"configmap", o.DistributionConfigMapName, "source_namespace", o.DistributionSourceNamespace)
+	}
+
+	if len(o.TrustAnchorConfigMap) > 0 && len(o.TrustAnchorSecret) > 0 {
+		return fmt.Errorf("only one of --trust-anchor-configmap or --trust-anchor-secret may be set")
+	}
+	for _, ref := range []struct {
+		flag, kind, value string
+	}{
+		{"--trust-anchor-configmap", trustanchor.KindConfigMap, o.TrustAnchorConfigMap},
+		{"--trust-anchor-secret", trustanchor.KindSecret, o.TrustAnchorSecret},
+	} {
+		if len(ref.value) == 0 {
+			continue
+		}
+		if len(o.TrustAnchorFilePaths) > 0 {
+			return fmt.Errorf("%s and --trust-anchor-file-path are mutually exclusive", ref.flag)
+		}
+		o.TrustAnchorObject, err = parseTrustAnchorObjectRef(ref.kind, ref.value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", ref.flag, err)
+		}
+		log.Info("using trust anchor from object", "kind", ref.kind, "object", ref.value)
 	}
 
-	if len(o.TrustAnchorFilePath) > 0 {
-		if _, err := os.Stat(o.TrustAnchorFilePath); err != nil {
-			return fmt.Errorf("failed to get trust anchor file %q: %w", o.TrustAnchorFilePath, err)
+	for _, path := range o.TrustAnchorFilePaths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to get trust anchor file %q: %w", path, err)
 		}
-		log.Info("using trust anchor from file", "file", o.TrustAnchorFilePath)
-	} else {
+		log.Info("using trust anchor from file", "file", path)
+	}
+	if len(o.TrustAnchorFilePaths) == 0 && o.TrustAnchorObject == nil {
 		log.Info("trust anchor file name not set, will use cert-manager Certificate")
 	}
 
+	for namespace, path := range o.NamespaceTrustAnchorFilePaths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to get trust anchor file %q for namespace %q: %w", path, namespace, err)
+		}
+		log.Info("using trust anchor from file for namespace", "file", path, "namespace", namespace)
+	}
+
+	if len(o.TrustBundleCertificateName) == 0 && !o.CertificateBindingsEnabled {
+		return fmt.Errorf("--trust-bundle-certificate-name must be set if --certificate-bindings-enabled is false")
+	}
+
+	if o.ProvisionCertificate {
+		if len(o.TrustBundleCertificateName) == 0 {
+			return fmt.Errorf("--provision-certificate requires --trust-bundle-certificate-name to be set")
+		}
+		if len(o.ProvisionIssuerName) == 0 {
+			return fmt.Errorf("--provision-issuer-name must be set if --provision-certificate is true")
+		}
+		if o.ProvisionRenewBefore <= 0 || o.ProvisionDuration <= o.ProvisionRenewBefore {
+			return fmt.Errorf("--provision-renew-before must be positive and shorter than --provision-duration")
+		}
+		switch o.ProvisionPrivateKeyAlgorithm {
+		case "ECDSA":
+			if o.ProvisionPrivateKeySize != 256 && o.ProvisionPrivateKeySize != 384 && o.ProvisionPrivateKeySize != 521 {
+				return fmt.Errorf("--provision-private-key-size must be one of 256, 384 or 521 for ECDSA: %d", o.ProvisionPrivateKeySize)
+			}
+		case "RSA":
+			if o.ProvisionPrivateKeySize < 2048 {
+				return fmt.Errorf("--provision-private-key-size must be at least 2048 for RSA: %d", o.ProvisionPrivateKeySize)
+			}
+		case "Ed25519":
+			o.ProvisionPrivateKeySize = 0
+		default:
+			return fmt.Errorf("--provision-private-key-algorithm must be one of ECDSA, RSA or Ed25519: %q", o.ProvisionPrivateKeyAlgorithm)
+		}
+		log.Info("provisioning cert-manager Certificate if it does not exist", "name", o.TrustBundleCertificateName,
+			"issuer", o.ProvisionIssuerName, "issuer_kind", o.ProvisionIssuerKind)
+	}
+
+	if o.TrustAnchorPruneGracePeriod < 0 {
+		return fmt.Errorf("--trust-anchor-prune-grace-period must not be negative")
+	}
+
+	if o.PruneExpiredTrustAnchors {
+		log.Info("pruning expired trust anchors", "grace_period", o.TrustAnchorPruneGracePeriod)
+	}
+
+	if o.JWKSPruneGracePeriod < 0 {
+		return fmt.Errorf("--jwks-prune-grace-period must not be negative")
+	}
+
+	if len(o.JWTSigningCertificateName) > 0 {
+		log.Info("managing dapr JWT signing key", "certificate", o.JWTSigningCertificateName, "jwks_prune_grace_period", o.JWKSPruneGracePeriod, "key_id", o.JWTKeyID)
+	}
+
+	if o.HistoryLimit < 0 {
+		return fmt.Errorf("--history-limit must not be negative")
+	}
+
+	if o.HistoryLimit > 0 {
+		log.Info("keeping dapr Secret history", "limit", o.HistoryLimit)
+	}
+
+	if len(o.TruststorePKCS12Key) > 0 || len(o.TruststoreJKSKey) > 0 {
+		var ok bool
+		o.TruststorePasswordSecretName, o.TruststorePasswordSecretKey, ok = strings.Cut(o.TruststorePasswordSecret, ":")
+		if !ok || len(o.TruststorePasswordSecretName) == 0 || len(o.TruststorePasswordSecretKey) == 0 {
+			return fmt.Errorf("--truststore-password-secret must be in the form <name>:<key> if truststores are enabled: %q", o.TruststorePasswordSecret)
+		}
+		switch o.TruststorePKCS12Profile {
+		case "LegacyRC2", "LegacyDES", "Modern2023":
+		default:
+			return fmt.Errorf("--truststore-pkcs12-profile must be one of LegacyRC2, LegacyDES or Modern2023: %q", o.TruststorePKCS12Profile)
+		}
+		log.Info("writing trust bundle truststores", "pkcs12_key", o.TruststorePKCS12Key, "jks_key", o.TruststoreJKSKey,
+			"password_secret", o.TruststorePasswordSecret)
+	}
+
+	// The dapr trust bundle Secret, the truststore password Secret, and the
+	// cert-manager Secret of the provisioned Certificate are always cached.
+	o.SecretNames = append(o.SecretNames, "dapr-trust-bundle")
+	if len(o.TruststorePasswordSecretName) > 0 {
+		o.SecretNames = append(o.SecretNames, o.TruststorePasswordSecretName)
+	}
+	if o.ProvisionCertificate {
+		o.SecretNames = append(o.SecretNames, o.TrustBundleCertificateName+"-from-cert-manager")
+	}
+	slices.Sort(o.SecretNames)
+	o.SecretNames = slices.Compact(slices.DeleteFunc(o.SecretNames, func(name string) bool { return len(name) == 0 }))
+	log.Info("only caching Secrets with names", "names", o.SecretNames)
+
+	if o.RootRotationSoakPeriod < 0 {
+		return fmt.Errorf("--root-rotation-soak-period must not be negative")
+	}
+
+	if o.RootRotationSoakPeriod > 0 {
+		log.Info("orchestrating root CA rotations", "soak_period", o.RootRotationSoakPeriod)
+	}
+
+	if o.ReplaceTrustAnchors {
+		if len(o.TrustAnchorFilePaths) == 0 && o.TrustAnchorObject == nil && len(o.NamespaceTrustAnchorFilePaths) == 0 {
+			return fmt.Errorf("--replace-trust-anchors requires --trust-anchor-file-path, --trust-anchor-configmap, --trust-anchor-secret or --namespace-trust-anchor-file-path to be set")
+		}
+		log.Info("replacing dapr trust anchors with those of the trust anchor source")
+	}
+
+	if o.BootstrapTrustBundle {
+		if len(o.SecretSelector) > 0 {
+			// The bootstrapped dapr Secrets must match the selector, or they will
+			// never be observed by the controller.
+			o.BootstrapLabels, err = labels.ConvertSelectorToLabelsMap(o.SecretSelector)
+			if err != nil {
+				return fmt.Errorf("--bootstrap-trust-bundle requires --secret-selector to only contain equality requirements: %w", err)
+			}
+		}
+		if o.BootstrapHelmAdopt != (len(o.BootstrapHelmRelease) > 0) {
+			return fmt.Errorf("--bootstrap-helm-adopt and --bootstrap-helm-release must be set together")
+		}
+		log.Info("bootstrapping dapr Secrets which do not exist", "helm_adopt", o.BootstrapHelmAdopt, "helm_release", o.BootstrapHelmRelease)
+	}
+
+	if o.DryRun {
+		log.Info("dry-run enabled, dapr Secrets will not be updated")
+	}
+
+	if len(o.PlanOutput) > 0 && o.PlanOutput != "text" && o.PlanOutput != "json" {
+		return fmt.Errorf("--output must be one of text, json: %q", o.PlanOutput)
+	}
+
+	if len(o.StatusOutput) > 0 && o.StatusOutput != "table" && o.StatusOutput != "json" && o.StatusOutput != "yaml" {
+		return fmt.Errorf("--output must be one of table, json, yaml: %q", o.StatusOutput)
+	}
+
+	if o.WebhookPort < 0 {
+		return fmt.Errorf("--webhook-port must not be negative")
+	}
+
+	if o.WebhookMode != "deny" && o.WebhookMode != "warn" {
+		return fmt.Errorf("--webhook-mode must be one of deny, warn: %q", o.WebhookMode)
+	}
+
+	if o.WebhookPort > 0 {
+		log.Info("serving dapr trust bundle validating webhook", "port", o.WebhookPort, "mode", o.WebhookMode)
+	}
+
+	if o.RollbackRevision < 0 {
+		return fmt.Errorf("--to must not be negative")
+	}
+
+	return nil
+}
+
+// completeRender validates the Options of the render command. The controller
+// only options, such as the dapr namespaces and Secrets to manage, are not
+// used by render so are not validated.
+func (o *Options) completeRender() error {
+	if len(o.TrustAnchorConfigMap) > 0 || len(o.TrustAnchorSecret) > 0 {
+		return fmt.Errorf("--trust-anchor-configmap and --trust-anchor-secret cannot be used with render, use --trust-anchor-file-path")
+	}
+	for _, path := range o.TrustAnchorFilePaths {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("failed to get trust anchor file %q: %w", path, err)
+		}
+	}
+
+	if o.TrustAnchorPruneGracePeriod < 0 {
+		return fmt.Errorf("--trust-anchor-prune-grace-period must not be negative")
+	}
+	if o.ReplaceTrustAnchors && len(o.TrustAnchorFilePaths) == 0 {
+		return fmt.Errorf("--replace-trust-anchors requires --trust-anchor-file-path to be set")
+	}
+
+	if (len(o.RenderSourceSecret) > 0) == (len(o.RenderIssuerCertFile) > 0 || len(o.RenderIssuerKeyFile) > 0) {
+		return fmt.Errorf("exactly one of --cert-manager-secret or --issuer-cert-file and --issuer-key-file must be set")
+	}
+	if len(o.RenderSourceSecret) == 0 && (len(o.RenderIssuerCertFile) == 0 || len(o.RenderIssuerKeyFile) == 0) {
+		return fmt.Errorf("--issuer-cert-file and --issuer-key-file must both be set")
+	}
+	if len(o.RenderNamespace) == 0 {
+		return fmt.Errorf("--namespace must be set")
+	}
+	if len(o.RenderOutput) > 0 && o.RenderOutput != "yaml" && o.RenderOutput != "json" {
+		return fmt.Errorf("--output must be one of yaml, json: %q", o.RenderOutput)
+	}
+
 	return nil
 }
 
-// addFlags add all Options flags to the given command.
-func (o *Options) addFlags(cmd *cobra.Command) {
+// parseTrustAnchorObjectRef parses a reference to a key of an object in the
+// form `<namespace>/<name>:<key>`.
+func parseTrustAnchorObjectRef(kind, value string) (*TrustAnchorObjectRef, error) {
+	ref := &TrustAnchorObjectRef{Kind: kind}
+
+	namespacedName, key, ok := strings.Cut(value, ":")
+	if ok {
+		ref.Key = key
+		ref.Namespace, ref.Name, ok = strings.Cut(namespacedName, "/")
+	}
+	if !ok || len(ref.Namespace) == 0 || len(ref.Name) == 0 || len(ref.Key) == 0 {
+		return nil, fmt.Errorf("must be in the form <namespace>/<name>:<key>: %q", value)
+	}
+
+	return ref, nil
+}
+
+// addFlags add all Options flags to the given command. extra optionally adds
+// command specific flag sets.
+func (o *Options) addFlags(cmd *cobra.Command, extra func(*cliflag.NamedFlagSets)) {
 	var nfs cliflag.NamedFlagSets
 
 	o.addAppFlags(nfs.FlagSet("App"))
 	o.kubeConfigFlags = genericclioptions.NewConfigFlags(true)
-	o.kubeConfigFlags.AddFlags(nfs.FlagSet("Kubernetes"))
+	if !o.offline {
+		o.kubeConfigFlags.AddFlags(nfs.FlagSet("Kubernetes"))
+	}
+	if extra != nil {
+		extra(&nfs)
+	}
 
 	usageFmt := "Usage:\n  %s\n"
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
@@ -130,15 +671,227 @@ func (o *Options) addAppFlags(fs *pflag.FlagSet) {
 		"metrics-port", 9402,
 		"Port to expose Prometheus metrics on 0.0.0.0 on path '/metrics'.")
 
-	fs.StringVar(&o.DaprNamespace,
-		"dapr-namespace", "dapr-system",
-		"Namespace where Dapr is installed.")
+	fs.StringSliceVar(&o.DaprNamespaces,
+		"dapr-namespace", []string{"dapr-system"},
+		"Namespaces where Dapr is installed. May be given multiple times, or as a comma separated list, to manage multiple Dapr control planes.")
+
+	fs.StringVar(&o.DaprNamespaceSelector,
+		"dapr-namespace-selector", "",
+		"Optional label selector which selects additional namespaces where Dapr is installed. Requires cluster wide read permissions.")
+
+	fs.StringSliceVar(&o.SecretNames,
+		"secret-names", []string{"dapr-trust-bundle-from-cert-manager"},
+		"Names of the only Secrets in the dapr namespaces which are cached and watched by the controller, which must include the cert-manager Secrets of the trust bundle, JWT and bound Certificates, and the target Secrets of DaprCertificateBindings. "+
+			"The controller exits on start if a Secret it reads is not included. dapr-trust-bundle, and the cert-manager Secret of the provisioned Certificate, are always included. May be given multiple times, or as a comma separated list.")
+
+	fs.StringVar(&o.SecretSelector,
+		"secret-selector", "",
+		"Optional label selector which further restricts the Secrets watched by the controller. If set, the source cert-manager Secrets and the target dapr Secrets must match the selector.")
+
+	fs.StringVar(&o.DistributionNamespaceSelector,
+		"trust-anchor-distribution-namespace-selector", "",
+		"Optional label selector which selects the namespaces the dapr trust anchors are written to as a ConfigMap, for non-dapr clients. The ConfigMap is deleted once a namespace stops matching. Requires cluster wide permissions.")
+
+	fs.StringVar(&o.DistributionConfigMapName,
+		"trust-anchor-distribution-configmap-name", "dapr-trust-anchors",
+		"Name of the ConfigMap the dapr trust anchors are distributed to, under the key `ca.crt`.")
+
+	fs.StringVar(&o.DistributionSourceNamespace,
+		"trust-anchor-distribution-source-namespace", "",
+		"Dapr namespace whose dapr-trust-bundle Secret trust anchors are distributed. Defaults to the first --dapr-namespace.")
+
+	fs.StringVar(&o.LeaderElectionNamespace,
+		"leader-election-namespace", "",
+		"Namespace to create the leader election Lease in. Defaults to the first --dapr-namespace.")
 
 	fs.StringVar(&o.TrustBundleCertificateName,
 		"trust-bundle-certificate-name", "dapr-trust-bundle",
 		"Name of the cert-manager Certificate which signs and manages the dapr trust bundle. Certificate must be in the same namespace as to where dapr is installed.")
 
-	fs.StringVar(&o.TrustAnchorFilePath,
-		"trust-anchor-file-path", "",
-		"Optional name of the file which contains the trust anchor. If empty, the trust anchor will be sourced from the cert-manager Certificate.")
+	fs.BoolVar(&o.ProvisionCertificate,
+		"provision-certificate", false,
+		"If true, the --trust-bundle-certificate-name cert-manager Certificate is created in each dapr namespace if it does not exist, as a dapr compatible CA signed by the --provision-issuer-name issuer. Provisioned Certificates are kept up to date with the provision flags.")
+
+	fs.StringVar(&o.ProvisionIssuerName,
+		"provision-issuer-name", "",
+		"Name of the cert-manager issuer which signs provisioned Certificates, typically a CA Issuer of the root CA.")
+
+	fs.StringVar(&o.ProvisionIssuerKind,
+		"provision-issuer-kind", "Issuer",
+		"Kind of the cert-manager issuer which signs provisioned Certificates.")
+
+	fs.StringVar(&o.ProvisionIssuerGroup,
+		"provision-issuer-group", "cert-manager.io",
+		"API group of the cert-manager issuer which signs provisioned Certificates.")
+
+	fs.DurationVar(&o.ProvisionDuration,
+		"provision-duration", time.Hour*24*90,
+		"Requested duration of provisioned Certificates.")
+
+	fs.DurationVar(&o.ProvisionRenewBefore,
+		"provision-renew-before", time.Hour*24*30,
+		"How long before expiry provisioned Certificates are renewed. Must be longer than the dapr workload certificate TTL.")
+
+	fs.StringVar(&o.ProvisionPrivateKeyAlgorithm,
+		"provision-private-key-algorithm", "ECDSA",
+		"Private key algorithm of provisioned Certificates, one of ECDSA, RSA or Ed25519.")
+
+	fs.IntVar(&o.ProvisionPrivateKeySize,
+		"provision-private-key-size", 256,
+		"Private key size of provisioned Certificates. Ignored for Ed25519.")
+
+	fs.StringVar(&o.JWTSigningCertificateName,
+		"jwt-signing-certificate-name", "",
+		"Optional name of the cert-manager Certificate whose private key is written as the dapr Sentry JWT signing key, and whose public key is appended to the JWKS in the dapr trust bundle Secret. Certificate must be in the same namespace as to where dapr is installed.")
+
+	fs.DurationVar(&o.JWKSPruneGracePeriod,
+		"jwks-prune-grace-period", 0,
+		"Duration after a key stopped being the JWT signing key before it is pruned from the JWKS. If zero, keys are never pruned.")
+
+	fs.StringVar(&o.JWTKeyID,
+		"jwt-key-id", "",
+		"Optional fixed key ID dapr Sentry signs JWTs with, which must match the key ID configured on dapr Sentry. If empty, the key ID of each signing key is its RFC 7638 JWK SHA-256 thumbprint. "+
+			"With a fixed key ID, the previous signing key is replaced in the JWKS rather than kept until it is pruned.")
+
+	fs.IntVar(&o.HistoryLimit,
+		"history-limit", 0,
+		"Number of previous revisions of the issuer and trust bundle of each dapr Secret to keep in the <secret>-history-0 to <secret>-history-<limit-1> Secrets, which can be restored with the rollback command. "+
+			"The oldest revision is overwritten once all are used. If zero, no history is kept.")
+
+	fs.StringVar(&o.TruststorePKCS12Key,
+		"truststore-pkcs12-key", "",
+		"Optional key of the dapr-trust-bundle Secret to write the trust bundle to as a PKCS#12 truststore, for example `truststore.p12`. Requires --truststore-password-secret.")
+
+	fs.StringVar(&o.TruststorePKCS12Profile,
+		"truststore-pkcs12-profile", "LegacyRC2",
+		"Profile of the PKCS#12 truststore, one of LegacyRC2, LegacyDES or Modern2023. Java versions before 11.0.12 only support the legacy profiles.")
+
+	fs.StringVar(&o.TruststoreJKSKey,
+		"truststore-jks-key", "",
+		"Optional key of the dapr-trust-bundle Secret to write the trust bundle to as a JKS truststore, for example `truststore.jks`. Requires --truststore-password-secret.")
+
+	fs.StringVar(&o.TruststorePasswordSecret,
+		"truststore-password-secret", "",
+		"Reference to a Secret key in each dapr namespace which contains the truststore password, in the form <name>:<key>.")
+
+	fs.StringSliceVar(&o.TrustAnchorFilePaths,
+		"trust-anchor-file-path", nil,
+		"Optional name of the file which contains the trust anchor. May be a directory, in which case every PEM file in the directory is loaded. May be given multiple times, or as a comma separated list, in which case all trust anchors are merged. If empty, the trust anchor will be sourced from the cert-manager Certificate.")
+
+	fs.StringVar(&o.TrustAnchorConfigMap,
+		"trust-anchor-configmap", "",
+		"Optional reference to a ConfigMap key which contains the trust anchor, in the form `<namespace>/<name>:<key>`, for example the target of a trust-manager Bundle. Mutually exclusive with --trust-anchor-file-path.")
+
+	fs.StringVar(&o.TrustAnchorSecret,
+		"trust-anchor-secret", "",
+		"Optional reference to a Secret key which contains the trust anchor, in the form `<namespace>/<name>:<key>`. Mutually exclusive with --trust-anchor-file-path.")
+
+	fs.StringToStringVar(&o.NamespaceTrustAnchorFilePaths,
+		"namespace-trust-anchor-file-path", nil,
+		"Optional map of dapr namespace to the name of the file which contains the trust anchor for that namespace, for example `tenant-a=/etc/tenant-a/ca.crt`. May be a directory. Overrides --trust-anchor-file-path for that namespace.")
+
+	fs.BoolVar(&o.PruneExpiredTrustAnchors,
+		"prune-expired-trust-anchors", false,
+		"If true, trust anchors will be removed from the dapr trust bundle once they have expired for longer than the grace period. The trust anchor of the current issuer is never removed.")
+
+	fs.DurationVar(&o.TrustAnchorPruneGracePeriod,
+		"trust-anchor-prune-grace-period", 0,
+		"Duration after a trust anchor has expired before it is pruned from the dapr trust bundle. Only used if --prune-expired-trust-anchors is true.")
+
+	fs.DurationVar(&o.RootRotationSoakPeriod,
+		"root-rotation-soak-period", 0,
+		"If non-zero, root CA rotations are orchestrated in phases. A new issuer which chains to a different root CA is held back until the new root CA has been in the dapr trust bundle for the soak period, and the old root CA is removed once the new issuer has been in use for the soak period.")
+
+	fs.BoolVar(&o.ReplaceTrustAnchors,
+		"replace-trust-anchors", false,
+		"If true, the dapr trust bundle is set to exactly the trust anchors of the trust anchor source, removing all others, rather than appended to. The issuer must chain to one of the trust anchors of the source. Requires a trust anchor source to be configured.")
+
+	fs.BoolVar(&o.CertificateBindingsEnabled,
+		"certificate-bindings-enabled", false,
+		"If true, a dapr Secret will be reconciled for every DaprCertificateBinding resource in the dapr namespace. Requires the DaprCertificateBinding CustomResourceDefinition to be installed.")
+
+	fs.IntVar(&o.WebhookPort,
+		"webhook-port", 0,
+		"Port to serve the validating webhook, which protects the dapr trust bundle Secret from destructive edits by other users, on 0.0.0.0. If zero, the webhook is disabled.")
+
+	fs.StringVar(&o.WebhookCertDir,
+		"webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs",
+		"Directory containing the tls.crt and tls.key of the webhook server.")
+
+	fs.StringVar(&o.WebhookMode,
+		"webhook-mode", "deny",
+		"Either deny, to reject edits of the dapr trust bundle Secret which remove currently valid trust anchors or set an issuer which does not chain to the trust bundle, or warn to allow them with a warning.")
+
+	fs.StringSliceVar(&o.WebhookAllowedUsernames,
+		"webhook-allowed-username", nil,
+		"Users whose edits of the dapr trust bundle Secret are never validated by the webhook, such as the dapr-cert-manager ServiceAccount. May be given multiple times, or as a comma separated list.")
+
+	fs.BoolVar(&o.BootstrapTrustBundle,
+		"bootstrap-trust-bundle", false,
+		"If true, dapr Secrets which do not exist, for example because dapr-cert-manager is installed before dapr, are created with the issuer and trust anchors so that dapr Sentry never generates its own root CA.")
+
+	fs.BoolVar(&o.BootstrapHelmAdopt,
+		"bootstrap-helm-adopt", false,
+		"If true, bootstrapped dapr Secrets are marked as owned by the Helm release --bootstrap-helm-release, so that installing dapr with Helm adopts them rather than failing. "+
+			"Every helm install or upgrade of dapr then overwrites the issuer and trust bundle of the Secrets with the data of the dapr chart, until dapr-cert-manager next reconciles them.")
+
+	fs.StringVar(&o.BootstrapHelmRelease,
+		"bootstrap-helm-release", "",
+		"Name of the Helm release dapr is installed with, which adopts the bootstrapped dapr Secrets. Requires --bootstrap-helm-adopt.")
+
+	fs.BoolVar(&o.DryRun,
+		"dry-run", false,
+		"If true, the changes which would be made to the dapr Secrets, and to the distributed trust anchor ConfigMaps, are logged rather than written.")
+}
+
+func (o *Options) addPlanFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.PlanOutput,
+		"output", "o", "text",
+		"Output format of the plan, either text or json.")
+}
+
+func (o *Options) addStatusFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&o.StatusOutput,
+		"output", "o", "table",
+		"Output format of the status, either table, json or yaml.")
+}
+
+func (o *Options) addRenderFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.RenderSourceSecret,
+		"cert-manager-secret", "",
+		"Path to the cert-manager Secret manifest, in YAML or JSON, to render the dapr trust bundle Secret from.")
+
+	fs.StringVar(&o.RenderIssuerCertFile,
+		"issuer-cert-file", "",
+		"Path to the PEM encoded issuer certificate, used in place of --cert-manager-secret.")
+
+	fs.StringVar(&o.RenderIssuerKeyFile,
+		"issuer-key-file", "",
+		"Path to the PEM encoded issuer private key, used in place of --cert-manager-secret.")
+
+	fs.StringVar(&o.RenderCAFile,
+		"ca-file", "",
+		"Optional path to the PEM encoded CA of the issuer, used in place of --cert-manager-secret.")
+
+	fs.StringVar(&o.RenderCurrentSecret,
+		"bundle", "",
+		"Optional path to the current dapr trust bundle Secret manifest, in YAML or JSON, whose trust anchors are merged with those of the issuer.")
+
+	fs.StringVar(&o.RenderNamespace,
+		"namespace", "dapr-system",
+		"Dapr namespace of the rendered Secret, when rendering from --issuer-cert-file and --issuer-key-file.")
+
+	fs.StringVarP(&o.RenderOutput,
+		"output", "o", "yaml",
+		"Output format of the rendered Secret, either yaml or json.")
+}
+
+func (o *Options) addRollbackFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.RollbackSecretName,
+		"secret", "dapr-trust-bundle",
+		"Name of the dapr certificate Secret to roll back.")
+
+	fs.IntVar(&o.RollbackRevision,
+		"to", 0,
+		"Revision to restore the dapr Secret to. If not set, the saved revisions are listed.")
 }
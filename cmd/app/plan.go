@@ -0,0 +1,196 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/diagridio/dapr-cert-manager/cmd/app/options"
+	"github.com/diagridio/dapr-cert-manager/pkg/controller"
+	"github.com/diagridio/dapr-cert-manager/pkg/trustanchor"
+)
+
+const (
+	planHelpOutput = "Print the changes dapr-cert-manager would make to the dapr trust bundle Secrets, without writing them"
+
+	planLongHelpOutput = planHelpOutput + `.
+
+Only the issuer and trust bundle of the dapr certificate Secrets are planned.
+Changes to the JWT signing key and JWKS, the truststores, provisioned
+cert-manager Certificates and distributed trust anchor ConfigMaps are not
+shown; run the controller with --dry-run to log those instead.`
+)
+
+// newPlanCommand returns the plan command, which prints the pending changes
+// to every managed dapr Secret.
+func newPlanCommand() *cobra.Command {
+	opts := options.New()
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: planHelpOutput,
+		Long:  planLongHelpOutput,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Complete(); err != nil {
+				return err
+			}
+
+			scheme, err := newScheme()
+			if err != nil {
+				return err
+			}
+
+			cl, err := client.New(opts.RestConfig, client.Options{Scheme: scheme})
+			if err != nil {
+				return fmt.Errorf("error creating kubernetes client: %w", err)
+			}
+
+			planOpts := controller.PlanOptions{
+				Options: controller.Options{
+					Log:                         opts.Logr,
+					DaprNamespaces:              opts.DaprNamespaces,
+					DaprNamespaceSelector:       opts.DaprNamespaceLabelSelector,
+					TrustBundleCertificateName:  opts.TrustBundleCertificateName,
+					PruneExpiredTrustAnchors:    opts.PruneExpiredTrustAnchors,
+					TrustAnchorPruneGracePeriod: opts.TrustAnchorPruneGracePeriod,
+					ReplaceTrustAnchors:         opts.ReplaceTrustAnchors,
+					RootRotationSoakPeriod:      opts.RootRotationSoakPeriod,
+					JWTSigningCertificateName:   opts.JWTSigningCertificateName,
+					JWKSPruneGracePeriod:        opts.JWKSPruneGracePeriod,
+					HistoryLimit:                opts.HistoryLimit,
+					CertificateBindingsEnabled:  opts.CertificateBindingsEnabled,
+				},
+				NamespaceTrustAnchors: make(map[string]x509bundle.Source),
+			}
+
+			if len(opts.TrustAnchorFilePaths) > 0 {
+				planOpts.TrustAnchor, err = trustanchor.Load(opts.TrustAnchorFilePaths...)
+				if err != nil {
+					return fmt.Errorf("failed to load trust anchor from files %q: %w", opts.TrustAnchorFilePaths, err)
+				}
+			}
+
+			if ref := opts.TrustAnchorObject; ref != nil {
+				planOpts.TrustAnchor, err = loadTrustAnchorObject(cmd.Context(), cl, ref)
+				if err != nil {
+					return err
+				}
+			}
+
+			for namespace, path := range opts.NamespaceTrustAnchorFilePaths {
+				planOpts.NamespaceTrustAnchors[namespace], err = trustanchor.Load(path)
+				if err != nil {
+					return fmt.Errorf("failed to load trust anchor from file %q for namespace %q: %w", path, namespace, err)
+				}
+			}
+
+			plans, err := controller.PlanTrustBundle(cmd.Context(), cl, planOpts)
+			if err != nil {
+				return err
+			}
+
+			if opts.PlanOutput == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(plans)
+			}
+
+			printPlans(cmd.OutOrStdout(), plans)
+			return nil
+		},
+	}
+
+	opts = opts.PreparePlan(cmd)
+
+	return cmd
+}
+
+// loadTrustAnchorObject loads the trust anchor from the referenced key of a
+// ConfigMap or Secret.
+func loadTrustAnchorObject(ctx context.Context, cl client.Reader, ref *options.TrustAnchorObjectRef) (*x509bundle.Bundle, error) {
+	key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+
+	var data []byte
+	switch ref.Kind {
+	case trustanchor.KindConfigMap:
+		var cm corev1.ConfigMap
+		if err := cl.Get(ctx, key, &cm); err != nil {
+			return nil, fmt.Errorf("failed to get trust anchor ConfigMap %s: %w", key, err)
+		}
+		data = []byte(cm.Data[ref.Key])
+		if len(data) == 0 {
+			data = cm.BinaryData[ref.Key]
+		}
+	case trustanchor.KindSecret:
+		var secret corev1.Secret
+		if err := cl.Get(ctx, key, &secret); err != nil {
+			return nil, fmt.Errorf("failed to get trust anchor Secret %s: %w", key, err)
+		}
+		data = secret.Data[ref.Key]
+	}
+
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trust anchor from %s %s key %q: %w", ref.Kind, key, ref.Key, err)
+	}
+
+	return bundle, nil
+}
+
+// printPlans writes a human readable summary of the given plans.
+func printPlans(w io.Writer, plans []controller.Plan) {
+	if len(plans) == 0 {
+		fmt.Fprintln(w, "No dapr Secrets are managed.")
+		return
+	}
+
+	for _, plan := range plans {
+		fmt.Fprintf(w, "%s/%s (Certificate %s):\n", plan.Namespace, plan.SecretName, plan.CertificateName)
+
+		switch {
+		case len(plan.Error) > 0:
+			fmt.Fprintf(w, "  error: %s\n", plan.Error)
+		case !plan.Pending:
+			fmt.Fprintln(w, "  no changes")
+		case plan.Issuer == nil && !plan.IssuerHeld && len(plan.RotationPhase) == 0 &&
+			len(plan.TrustAnchorsAdded) == 0 && len(plan.TrustAnchorsRemoved) == 0:
+			fmt.Fprintln(w, "  ~ issuer private key")
+		}
+
+		if len(plan.RotationPhase) > 0 {
+			fmt.Fprintf(w, "  ~ root rotation phase %s\n", plan.RotationPhase)
+		}
+		if plan.IssuerHeld {
+			fmt.Fprintln(w, "  = issuer held back until its root CA has soaked")
+		}
+
+		if plan.Issuer != nil {
+			from := "none"
+			if plan.Issuer.From != nil {
+				from = plan.Issuer.From.Serial
+			}
+			fmt.Fprintf(w, "  ~ issuer serial %s -> %s\n", from, plan.Issuer.To.Serial)
+		}
+		for _, cert := range plan.TrustAnchorsAdded {
+			fmt.Fprintf(w, "  + trust anchor %s\n", describeSummary(cert))
+		}
+		for _, cert := range plan.TrustAnchorsRemoved {
+			fmt.Fprintf(w, "  - trust anchor %s\n", describeSummary(cert))
+		}
+	}
+}
+
+// describeSummary returns a single line description of the given certificate
+// summary.
+func describeSummary(cert controller.CertificateSummary) string {
+	return fmt.Sprintf("subject=%q serial=%s sha256=%s not_after=%s",
+		cert.Subject, cert.Serial, cert.Fingerprint, cert.NotAfter.Format(time.RFC3339))
+}
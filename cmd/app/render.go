@@ -0,0 +1,145 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/diagridio/dapr-cert-manager/cmd/app/options"
+	"github.com/diagridio/dapr-cert-manager/pkg/controller"
+	"github.com/diagridio/dapr-cert-manager/pkg/trustanchor"
+)
+
+const (
+	renderHelpOutput = "Render the dapr trust bundle Secret from a cert-manager Secret offline, without connecting to a cluster"
+)
+
+// newRenderCommand returns the render command, which prints the dapr trust
+// bundle Secret the controller would write, for clusters where Secrets are
+// only written through GitOps.
+func newRenderCommand() *cobra.Command {
+	opts := options.New()
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: renderHelpOutput,
+		Long:  renderHelpOutput,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Complete(); err != nil {
+				return err
+			}
+
+			renderOpts := controller.RenderOptions{
+				Log:                         opts.Logr,
+				PruneExpiredTrustAnchors:    opts.PruneExpiredTrustAnchors,
+				TrustAnchorPruneGracePeriod: opts.TrustAnchorPruneGracePeriod,
+				ReplaceTrustAnchors:         opts.ReplaceTrustAnchors,
+			}
+
+			var err error
+			if len(opts.RenderSourceSecret) > 0 {
+				renderOpts.Source, err = readSecretManifest(opts.RenderSourceSecret)
+				if err != nil {
+					return err
+				}
+			} else {
+				renderOpts.Source, err = readSecretPEMFiles(opts.RenderNamespace, map[string]string{
+					corev1.TLSCertKey:       opts.RenderIssuerCertFile,
+					corev1.TLSPrivateKeyKey: opts.RenderIssuerKeyFile,
+					cmmeta.TLSCAKey:         opts.RenderCAFile,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(opts.RenderCurrentSecret) > 0 {
+				renderOpts.Current, err = readSecretManifest(opts.RenderCurrentSecret)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(opts.TrustAnchorFilePaths) > 0 {
+				renderOpts.TrustAnchor, err = trustanchor.Load(opts.TrustAnchorFilePaths...)
+				if err != nil {
+					return fmt.Errorf("failed to load trust anchor from files %q: %w", opts.TrustAnchorFilePaths, err)
+				}
+			}
+
+			secret, err := controller.RenderTrustBundle(renderOpts)
+			if err != nil {
+				return err
+			}
+
+			if opts.RenderOutput == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(secret)
+			}
+
+			b, err := yaml.Marshal(secret)
+			if err != nil {
+				return err
+			}
+			_, err = cmd.OutOrStdout().Write(b)
+			return err
+		},
+	}
+
+	opts = opts.PrepareRender(cmd)
+
+	return cmd
+}
+
+// readSecretManifest reads a Secret from the YAML or JSON manifest at the
+// given path. StringData is merged into Data, as the API server would.
+func readSecretManifest(path string) (corev1.Secret, error) {
+	var secret corev1.Secret
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return secret, fmt.Errorf("failed to read Secret manifest %q: %w", path, err)
+	}
+	if err := yaml.Unmarshal(b, &secret); err != nil {
+		return secret, fmt.Errorf("failed to parse Secret manifest %q: %w", path, err)
+	}
+	if len(secret.Kind) > 0 && secret.Kind != "Secret" {
+		return secret, fmt.Errorf("manifest %q is a %s, not a Secret", path, secret.Kind)
+	}
+
+	for key, value := range secret.StringData {
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[key] = []byte(value)
+	}
+	secret.StringData = nil
+
+	return secret, nil
+}
+
+// readSecretPEMFiles returns a Secret in the given namespace whose data keys
+// are read from the given files. Keys with an empty path are skipped.
+func readSecretPEMFiles(namespace string, files map[string]string) (corev1.Secret, error) {
+	secret := corev1.Secret{Data: make(map[string][]byte)}
+	secret.Namespace = namespace
+
+	for key, path := range files {
+		if len(path) == 0 {
+			continue
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return secret, fmt.Errorf("failed to read %s from %q: %w", key, path, err)
+		}
+		secret.Data[key] = b
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/diagridio/dapr-cert-manager/cmd/app/options"
+	"github.com/diagridio/dapr-cert-manager/pkg/controller"
+)
+
+const (
+	rollbackHelpOutput = "Restore the issuer and trust bundle of a dapr Secret to a saved revision, and pause its reconciliation"
+)
+
+// newRollbackCommand returns the rollback command, which lists the saved
+// revisions of a dapr Secret, or restores one of them.
+func newRollbackCommand() *cobra.Command {
+	opts := options.New()
+
+	cmd := &cobra.Command{
+		Use:   "rollback",
+		Short: rollbackHelpOutput,
+		Long:  rollbackHelpOutput,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Complete(); err != nil {
+				return err
+			}
+
+			if len(opts.DaprNamespaces) != 1 {
+				return fmt.Errorf("rollback requires exactly one --dapr-namespace, got %v", opts.DaprNamespaces)
+			}
+			namespace := opts.DaprNamespaces[0]
+
+			scheme, err := newScheme()
+			if err != nil {
+				return err
+			}
+
+			cl, err := client.New(opts.RestConfig, client.Options{Scheme: scheme})
+			if err != nil {
+				return fmt.Errorf("error creating kubernetes client: %w", err)
+			}
+
+			if opts.RollbackRevision == 0 {
+				revisions, err := controller.History(cmd.Context(), cl, namespace, opts.RollbackSecretName)
+				if err != nil {
+					return err
+				}
+				printRevisions(cmd.OutOrStdout(), namespace, opts.RollbackSecretName, revisions)
+				return nil
+			}
+
+			if err := controller.Rollback(cmd.Context(), cl, namespace, opts.RollbackSecretName, opts.RollbackRevision); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Restored %s/%s to revision %d. Reconciliation is paused; remove the %s annotation from the Secret to resume.\n",
+				namespace, opts.RollbackSecretName, opts.RollbackRevision, controller.AnnotationPaused)
+			return nil
+		},
+	}
+
+	opts = opts.PrepareRollback(cmd)
+
+	return cmd
+}
+
+// printRevisions writes a human readable summary of the given revisions.
+func printRevisions(w io.Writer, namespace, secretName string, revisions []controller.Revision) {
+	if len(revisions) == 0 {
+		fmt.Fprintf(w, "No revisions of %s/%s are saved.\n", namespace, secretName)
+		return
+	}
+
+	for _, revision := range revisions {
+		fmt.Fprintf(w, "revision %d (%s, saved %s):\n", revision.Revision, revision.Name, revision.CreationTime.Format(time.RFC3339))
+		if revision.Issuer != nil {
+			fmt.Fprintf(w, "  issuer %s\n", describeSummary(*revision.Issuer))
+		}
+		for _, cert := range revision.TrustAnchors {
+			fmt.Fprintf(w, "  trust anchor %s\n", describeSummary(cert))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	"github.com/diagridio/dapr-cert-manager/cmd/app/options"
+	"github.com/diagridio/dapr-cert-manager/pkg/controller"
+)
+
+const (
+	statusHelpOutput = "Print the live state of the dapr trust bundle Secrets managed by dapr-cert-manager"
+)
+
+// newStatusCommand returns the status command, which prints the issuer and
+// trust anchors of every managed dapr Secret, and whether they are in sync
+// with cert-manager.
+func newStatusCommand() *cobra.Command {
+	opts := options.New()
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: statusHelpOutput,
+		Long:  statusHelpOutput,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := opts.Complete(); err != nil {
+				return err
+			}
+
+			scheme, err := newScheme()
+			if err != nil {
+				return err
+			}
+
+			cl, err := client.New(opts.RestConfig, client.Options{Scheme: scheme})
+			if err != nil {
+				return fmt.Errorf("error creating kubernetes client: %w", err)
+			}
+
+			statuses, err := controller.StatusTrustBundle(cmd.Context(), cl, controller.Options{
+				Log:                        opts.Logr,
+				DaprNamespaces:             opts.DaprNamespaces,
+				DaprNamespaceSelector:      opts.DaprNamespaceLabelSelector,
+				TrustBundleCertificateName: opts.TrustBundleCertificateName,
+				CertificateBindingsEnabled: opts.CertificateBindingsEnabled,
+			})
+			if err != nil {
+				return err
+			}
+
+			switch opts.StatusOutput {
+			case "json":
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(statuses)
+			case "yaml":
+				b, err := yaml.Marshal(statuses)
+				if err != nil {
+					return err
+				}
+				_, err = cmd.OutOrStdout().Write(b)
+				return err
+			}
+
+			return printStatuses(cmd.OutOrStdout(), statuses)
+		},
+	}
+
+	opts = opts.PrepareStatus(cmd)
+
+	return cmd
+}
+
+// printStatuses writes the given statuses as tables; one row per dapr Secret,
+// followed by one row per trust anchor.
+func printStatuses(w io.Writer, statuses []controller.Status) error {
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, "No dapr Secrets are managed.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tSECRET\tCERTIFICATE\tIN SYNC\tCHAINS TO BUNDLE\tISSUER SUBJECT\tISSUER SERIAL\tISSUER EXPIRY\tERROR")
+	for _, status := range statuses {
+		subject, serial, expiry := "-", "-", "-"
+		if status.Issuer != nil {
+			subject = status.Issuer.Subject
+			serial = status.Issuer.Serial
+			expiry = status.Issuer.NotAfter.Format(time.RFC3339)
+		}
+		inSync := fmt.Sprint(status.InSync)
+		if status.Paused {
+			inSync += " (paused)"
+		}
+		errMsg := status.Error
+		if len(errMsg) == 0 {
+			errMsg = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\t%s\n",
+			status.Namespace, status.SecretName, status.CertificateName, inSync, status.IssuerChainsToBundle,
+			subject, serial, expiry, errMsg)
+	}
+
+	fmt.Fprintln(tw)
+	fmt.Fprintln(tw, "NAMESPACE\tSECRET\tTRUST ANCHOR SUBJECT\tSHA256\tEXPIRY")
+	for _, status := range statuses {
+		secretName := status.CASecretName
+		if len(secretName) == 0 {
+			secretName = status.SecretName
+		}
+		for _, cert := range status.TrustAnchors {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+				status.Namespace, secretName, cert.Subject, cert.Fingerprint, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	return tw.Flush()
+}
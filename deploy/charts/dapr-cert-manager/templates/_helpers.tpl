@@ -26,3 +26,178 @@ app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
 app.kubernetes.io/managed-by: {{ .Release.Service }}
 {{- end -}}
 
+
+{{/*
+Comma separated list of the dapr namespaces which are managed.
+*/}}
+{{- define "dapr-cert-manager.daprNamespaces" -}}
+{{- concat (list .Values.app.daprNamespace) .Values.app.daprNamespaces | compact | uniq | join "," -}}
+{{- end -}}
+
+{{/*
+Namespace the leader election Lease is created in.
+*/}}
+{{- define "dapr-cert-manager.leaderElectionNamespace" -}}
+{{- $namespaces := include "dapr-cert-manager.daprNamespaces" . | splitList "," | compact -}}
+{{- if .Values.app.leaderElectionNamespace -}}
+{{- .Values.app.leaderElectionNamespace -}}
+{{- else if $namespaces -}}
+{{- first $namespaces -}}
+{{- else -}}
+{{- .Release.Namespace -}}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Comma separated list of the names of the Secrets which are cached and may be
+read in each managed dapr namespace. Besides the configured names, these are
+the spec.secretName of the watched Certificates, and the source and target
+Secrets of the DaprCertificateBindings, which exist in the dapr namespaces at
+install or upgrade.
+*/}}
+{{- define "dapr-cert-manager.secretNames" -}}
+{{- $names := concat (list "dapr-trust-bundle" .Values.app.truststores.passwordSecret.name) .Values.app.secretNames .Values.app.certificateBindings.targetSecretNames -}}
+{{- if .Values.app.provision.enabled -}}
+{{- $names = append $names (printf "%s-from-cert-manager" .Values.app.trustBundleCertificateName) -}}
+{{- end -}}
+{{- range include "dapr-cert-manager.daprNamespaces" . | splitList "," | compact -}}
+{{- $namespace := . -}}
+{{- $certNames := list $.Values.app.trustBundleCertificateName $.Values.app.jwtSigningCertificateName -}}
+{{- if $.Values.app.certificateBindings.enabled -}}
+{{- range (lookup "dapr-cert-manager.diagrid.io/v1alpha1" "DaprCertificateBinding" $namespace "").items -}}
+{{- $certNames = append $certNames .spec.certificateName -}}
+{{- $names = append (append $names .spec.target.secretName) (.spec.target.caSecretName | default "") -}}
+{{- end -}}
+{{- end -}}
+{{- range $certNames | compact -}}
+{{- with lookup "cert-manager.io/v1" "Certificate" $namespace . -}}
+{{- $names = append $names .spec.secretName -}}
+{{- end -}}
+{{- end -}}
+{{- end -}}
+{{- $names | compact | uniq | join "," -}}
+{{- end -}}
+
+{{/*
+Comma separated list of the names of the history Secrets of the dapr Secrets,
+`<secret>-history-0` to `<secret>-history-<historyLimit-1>`.
+*/}}
+{{- define "dapr-cert-manager.historySecretNames" -}}
+{{- $names := list -}}
+{{- range concat (list "dapr-trust-bundle") .Values.app.certificateBindings.targetSecretNames | compact | uniq -}}
+{{- $name := . -}}
+{{- range until (int $.Values.app.historyLimit) -}}
+{{- $names = append $names (printf "%s-history-%d" $name .) -}}
+{{- end -}}
+{{- end -}}
+{{- $names | join "," -}}
+{{- end -}}
+
+{{/*
+RBAC rules required in each managed dapr namespace.
+*/}}
+{{- define "dapr-cert-manager.rules" -}}
+# Only allow reading the managed Secrets, which are listed and watched by name.
+- apiGroups:
+  - ""
+  resources:
+  - "secrets"
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
+  resourceNames:
+  {{- range include "dapr-cert-manager.secretNames" . | splitList "," }}
+  - {{ . }}
+  {{- end }}
+# Only allow patching the dapr Secrets.
+- apiGroups:
+  - ""
+  resources:
+  - "secrets"
+  verbs:
+  - "patch"
+  resourceNames:
+  - dapr-trust-bundle
+  {{- range .Values.app.certificateBindings.targetSecretNames }}
+  - {{ . }}
+  {{- end }}
+{{- if gt (int .Values.app.historyLimit) 0 }}
+# Only allow reading and updating the fixed history Secrets of the dapr
+# Secrets.
+- apiGroups:
+  - ""
+  resources:
+  - "secrets"
+  verbs:
+  - "get"
+  - "patch"
+  resourceNames:
+  {{- range include "dapr-cert-manager.historySecretNames" . | splitList "," }}
+  - {{ . }}
+  {{- end }}
+# Allow creating the history Secrets which do not exist yet. Creates can't be
+# restricted by name.
+- apiGroups:
+  - ""
+  resources:
+  - "secrets"
+  verbs:
+  - "create"
+{{- end }}
+{{- if .Values.app.bootstrap.enabled }}
+# Allow creating the dapr Secrets which do not exist. Creates can't be
+# restricted by name.
+- apiGroups:
+  - ""
+  resources:
+  - "secrets"
+  verbs:
+  - "create"
+{{- end }}
+- apiGroups:
+  - "cert-manager.io"
+  resources:
+  - "certificates"
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
+{{- if .Values.app.provision.enabled }}
+# Allow provisioning the trust-bundle Certificate, and keeping it up to date.
+- apiGroups:
+  - "cert-manager.io"
+  resources:
+  - "certificates"
+  verbs:
+  - "create"
+  - "patch"
+{{- end }}
+{{- if .Values.app.certificateBindings.enabled }}
+- apiGroups:
+  - "dapr-cert-manager.diagrid.io"
+  resources:
+  - "daprcertificatebindings"
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
+{{- end }}
+# Read the dapr system Configuration to validate the issuer is compatible with
+# dapr Sentry.
+- apiGroups:
+  - "dapr.io"
+  resources:
+  - "configurations"
+  verbs:
+  - "get"
+  - "list"
+  - "watch"
+  resourceNames:
+  - daprsystem
+- apiGroups:
+  - ""
+  resources:
+  - "events"
+  verbs: ["create", "patch"]
+{{- end -}}
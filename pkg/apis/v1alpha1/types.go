@@ -0,0 +1,90 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// DefaultCertificateKey is the default Secret key the issuer certificate is
+	// written to.
+	DefaultCertificateKey = "issuer.crt"
+
+	// DefaultPrivateKeyKey is the default Secret key the issuer private key is
+	// written to.
+	DefaultPrivateKeyKey = "issuer.key"
+
+	// DefaultCAKey is the default Secret key the trust anchors are written to.
+	DefaultCAKey = "ca.crt"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Namespaced,shortName=dcb
+// +kubebuilder:printcolumn:name="Certificate",type="string",JSONPath=".spec.certificateName"
+// +kubebuilder:printcolumn:name="Secret",type="string",JSONPath=".spec.target.secretName"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DaprCertificateBinding declares that the issuer certificate, private key and
+// trust anchors of a cert-manager Certificate should be written to a dapr
+// Secret in the same namespace.
+type DaprCertificateBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DaprCertificateBindingSpec `json:"spec"`
+}
+
+// DaprCertificateBindingSpec defines the source Certificate and target Secret
+// of a DaprCertificateBinding.
+type DaprCertificateBindingSpec struct {
+	// CertificateName is the name of the cert-manager Certificate in the same
+	// namespace whose Secret is used as the source of the issuer certificate,
+	// private key and trust anchors.
+	// +kubebuilder:validation:MinLength=1
+	CertificateName string `json:"certificateName"`
+
+	// Target is the dapr Secret which is written to.
+	Target DaprCertificateBindingTarget `json:"target"`
+}
+
+// DaprCertificateBindingTarget defines the dapr Secret, and the keys within
+// it, which a DaprCertificateBinding writes to.
+type DaprCertificateBindingTarget struct {
+	// SecretName is the name of the Secret in the same namespace which the
+	// issuer certificate and private key are written to.
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+
+	// CASecretName is the name of the Secret in the same namespace which the
+	// trust anchors are written to. Defaults to SecretName.
+	// +optional
+	CASecretName string `json:"caSecretName,omitempty"`
+
+	// CertificateKey is the Secret key the issuer certificate is written to.
+	// Defaults to `issuer.crt`.
+	// +optional
+	CertificateKey string `json:"certificateKey,omitempty"`
+
+	// PrivateKeyKey is the Secret key the issuer private key is written to.
+	// Defaults to `issuer.key`.
+	// +optional
+	PrivateKeyKey string `json:"privateKeyKey,omitempty"`
+
+	// CAKey is the Secret key the trust anchors are written to. Defaults to
+	// `ca.crt`.
+	// +optional
+	CAKey string `json:"caKey,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DaprCertificateBindingList is a list of DaprCertificateBindings.
+type DaprCertificateBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []DaprCertificateBinding `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DaprCertificateBinding{}, &DaprCertificateBindingList{})
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+)
+
+// secretConfFromBinding returns the secretConf declared by the given
+// DaprCertificateBinding, with defaults applied.
+func secretConfFromBinding(binding *v1alpha1.DaprCertificateBinding) secretConf {
+	target := binding.Spec.Target
+
+	conf := secretConf{
+		certName:        binding.Spec.CertificateName,
+		certSecretName:  target.SecretName,
+		caSecretName:    target.CASecretName,
+		certSectretKey:  target.CertificateKey,
+		certSecretPKKey: target.PrivateKeyKey,
+		certSecretCAKey: target.CAKey,
+	}
+
+	if len(conf.caSecretName) == 0 {
+		conf.caSecretName = conf.certSecretName
+	}
+	if len(conf.certSectretKey) == 0 {
+		conf.certSectretKey = v1alpha1.DefaultCertificateKey
+	}
+	if len(conf.certSecretPKKey) == 0 {
+		conf.certSecretPKKey = v1alpha1.DefaultPrivateKeyKey
+	}
+	if len(conf.certSecretCAKey) == 0 {
+		conf.certSecretCAKey = v1alpha1.DefaultCAKey
+	}
+
+	return conf
+}
+
+// secretTarget is a key of a Secret written by a secretConf.
+type secretTarget struct {
+	secretName string
+	key        string
+}
+
+// targets returns the Secret keys written by the secretConf.
+func (c secretConf) targets() []secretTarget {
+	targets := []secretTarget{
+		{secretName: c.certSecretName, key: c.certSectretKey},
+		{secretName: c.certSecretName, key: c.certSecretPKKey},
+	}
+	if len(c.caSecretName) > 0 {
+		targets = append(targets, secretTarget{secretName: c.caSecretName, key: c.certSecretCAKey})
+	}
+	return targets
+}
+
+// secretConfs returns all secretConfs which should be reconciled in the given
+// dapr namespace; those configured by Options, and those declared by
+// DaprCertificateBindings in the namespace. Bindings which conflict with an
+// earlier secretConf are skipped.
+func (s *secretCtrl) secretConfs(ctx context.Context, namespace string) ([]secretConf, error) {
+	confs, _, err := s.listSecretConfs(ctx, namespace)
+	return confs, err
+}
+
+// bindingConflict is a DaprCertificateBinding which is skipped, since it
+// writes a Secret key which is already written by another secretConf, or
+// writes the same Secret key more than once itself.
+type bindingConflict struct {
+	binding *v1alpha1.DaprCertificateBinding
+	target  secretTarget
+	owner   secretConf
+	// self is true if the binding itself writes the target more than once, in
+	// which case owner is the secretConf of the binding.
+	self bool
+}
+
+// duplicateTarget returns the first Secret key which is written more than once
+// by the secretConf, for example a certificate key which is the same as the CA
+// key of the same Secret.
+func (c secretConf) duplicateTarget() (secretTarget, bool) {
+	seen := make(map[secretTarget]struct{})
+	for _, target := range c.targets() {
+		if _, ok := seen[target]; ok {
+			return target, true
+		}
+		seen[target] = struct{}{}
+	}
+	return secretTarget{}, false
+}
+
+// listSecretConfs returns the secretConfs which should be reconciled in the
+// given dapr namespace, and the DaprCertificateBindings which are skipped
+// since they conflict with an earlier secretConf, or with themselves. Secret
+// keys are only ever written once by a single secretConf, since secretConfs
+// are reconciled concurrently. Bindings are ordered by creation, so that the
+// binding which was created last is skipped.
+func (s *secretCtrl) listSecretConfs(ctx context.Context, namespace string) ([]secretConf, []bindingConflict, error) {
+	confs := append([]secretConf{}, s.confs...)
+	if !s.bindingsEnabled {
+		return confs, nil, nil
+	}
+
+	var bindings v1alpha1.DaprCertificateBindingList
+	if err := s.lister.List(ctx, &bindings, client.InNamespace(namespace)); err != nil {
+		return nil, nil, fmt.Errorf("failed to list DaprCertificateBindings: %w", err)
+	}
+
+	slices.SortFunc(bindings.Items, func(a, b v1alpha1.DaprCertificateBinding) int {
+		if c := a.CreationTimestamp.Compare(b.CreationTimestamp.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	owners := make(map[secretTarget]secretConf)
+	for _, conf := range confs {
+		for _, target := range conf.targets() {
+			owners[target] = conf
+		}
+	}
+
+	var conflicts []bindingConflict
+	for i := range bindings.Items {
+		conf := secretConfFromBinding(&bindings.Items[i])
+		if target, ok := conf.duplicateTarget(); ok {
+			conflicts = append(conflicts, bindingConflict{binding: &bindings.Items[i], target: target, owner: conf, self: true})
+			continue
+		}
+
+		conflict := slices.IndexFunc(conf.targets(), func(target secretTarget) bool {
+			_, ok := owners[target]
+			return ok
+		})
+		if conflict >= 0 {
+			target := conf.targets()[conflict]
+			conflicts = append(conflicts, bindingConflict{binding: &bindings.Items[i], target: target, owner: owners[target]})
+			continue
+		}
+
+		for _, target := range conf.targets() {
+			owners[target] = conf
+		}
+		confs = append(confs, conf)
+	}
+
+	return confs, conflicts, nil
+}
+
+// managesSecret returns true if the Secret with the given namespace and name
+// is the target of any secretConf.
+func (s *secretCtrl) managesSecret(ctx context.Context, namespace, name string) bool {
+	if len(s.jwtCertName) > 0 && name == jwtSecretName {
+		return true
+	}
+	confs, err := s.secretConfs(ctx, namespace)
+	if err != nil {
+		s.log.Error(err, "failed to get secret configurations")
+		return false
+	}
+	for _, conf := range confs {
+		if conf.certSecretName == name || conf.caSecretName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// watchesCertificate returns true if the cert-manager Certificate with the
+// given namespace and name is the source of any secretConf.
+func (s *secretCtrl) watchesCertificate(ctx context.Context, namespace, name string) bool {
+	if len(s.jwtCertName) > 0 && name == s.jwtCertName {
+		return true
+	}
+	confs, err := s.secretConfs(ctx, namespace)
+	if err != nil {
+		s.log.Error(err, "failed to get secret configurations")
+		return false
+	}
+	for _, conf := range confs {
+		if conf.certName == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+)
+
+func Test_secretConfFromBinding(t *testing.T) {
+	tests := map[string]struct {
+		spec v1alpha1.DaprCertificateBindingSpec
+		exp  secretConf
+	}{
+		"empty keys should be defaulted": {
+			spec: v1alpha1.DaprCertificateBindingSpec{
+				CertificateName: "my-cert",
+				Target:          v1alpha1.DaprCertificateBindingTarget{SecretName: "my-secret"},
+			},
+			exp: secretConf{
+				certName:        "my-cert",
+				certSecretName:  "my-secret",
+				caSecretName:    "my-secret",
+				certSectretKey:  "issuer.crt",
+				certSecretPKKey: "issuer.key",
+				certSecretCAKey: "ca.crt",
+			},
+		},
+		"set keys should be used": {
+			spec: v1alpha1.DaprCertificateBindingSpec{
+				CertificateName: "my-cert",
+				Target: v1alpha1.DaprCertificateBindingTarget{
+					SecretName:     "my-secret",
+					CASecretName:   "my-ca-secret",
+					CertificateKey: "tls.crt",
+					PrivateKeyKey:  "tls.key",
+					CAKey:          "root.pem",
+				},
+			},
+			exp: secretConf{
+				certName:        "my-cert",
+				certSecretName:  "my-secret",
+				caSecretName:    "my-ca-secret",
+				certSectretKey:  "tls.crt",
+				certSecretPKKey: "tls.key",
+				certSecretCAKey: "root.pem",
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := secretConfFromBinding(&v1alpha1.DaprCertificateBinding{Spec: test.spec})
+			if got != test.exp {
+				t.Errorf("unexpected secretConf, exp=%+v got=%+v", test.exp, got)
+			}
+		})
+	}
+}
+
+func Test_listSecretConfs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	binding := func(name string, created time.Time, target v1alpha1.DaprCertificateBindingTarget) client.Object {
+		return &v1alpha1.DaprCertificateBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: name, CreationTimestamp: metav1.NewTime(created)},
+			Spec:       v1alpha1.DaprCertificateBindingSpec{CertificateName: name, Target: target},
+		}
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		binding("first", now.Add(-time.Hour), v1alpha1.DaprCertificateBindingTarget{SecretName: "app-secret"}),
+		// Writes the same issuer keys as the earlier binding.
+		binding("second", now, v1alpha1.DaprCertificateBindingTarget{SecretName: "app-secret", CASecretName: "app-ca"}),
+		// Writes the trust anchors of the trust bundle Certificate.
+		binding("third", now, v1alpha1.DaprCertificateBindingTarget{SecretName: "other-secret", CASecretName: "dapr-trust-bundle"}),
+		// Writes different keys of the same Secret.
+		binding("fourth", now, v1alpha1.DaprCertificateBindingTarget{
+			SecretName: "app-secret", CASecretName: "app-secret",
+			CertificateKey: "tls.crt", PrivateKeyKey: "tls.key", CAKey: "root.pem",
+		}),
+		// Writes the certificate and trust anchors to the same key.
+		binding("fifth", now, v1alpha1.DaprCertificateBindingTarget{
+			SecretName: "fifth-secret", CertificateKey: "ca.crt",
+		}),
+		// Writes the certificate and private key to the same key.
+		binding("sixth", now, v1alpha1.DaprCertificateBindingTarget{
+			SecretName: "sixth-secret", CASecretName: "sixth-ca", CertificateKey: "tls.pem", PrivateKeyKey: "tls.pem",
+		}),
+	).Build()
+
+	s := &secretCtrl{lister: cl, bindingsEnabled: true, confs: []secretConf{testSecretConf}}
+	confs, conflicts, err := s.listSecretConfs(context.Background(), "dapr-system")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotConfs []string
+	for _, conf := range confs {
+		gotConfs = append(gotConfs, conf.certName)
+	}
+	if exp := []string{"dapr-trust-bundle", "first", "fourth"}; !slices.Equal(gotConfs, exp) {
+		t.Errorf("unexpected secretConfs, exp=%v got=%v", exp, gotConfs)
+	}
+
+	var gotConflicts []string
+	for _, conflict := range conflicts {
+		gotConflicts = append(gotConflicts, conflict.binding.Name+"->"+conflict.owner.certName)
+		if conflict.self != (conflict.binding.Name == conflict.owner.certName) {
+			t.Errorf("unexpected self conflict of binding %q", conflict.binding.Name)
+		}
+	}
+	if exp := []string{"fifth->fifth", "second->first", "sixth->sixth", "third->dapr-trust-bundle"}; !slices.Equal(gotConflicts, exp) {
+		t.Errorf("unexpected conflicts, exp=%v got=%v", exp, gotConflicts)
+	}
+}
@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Steps of creating the missing dapr Secrets.
+	writeStepBootstrap = "bootstrap"
+)
+
+// BootstrapOptions configure the creation of dapr Secrets which do not exist,
+// for example because dapr-cert-manager is installed before dapr.
+type BootstrapOptions struct {
+	// Enabled creates the dapr Secrets with the issuer and trust anchors if
+	// they do not exist, so that dapr Sentry never generates its own
+	// self-signed root CA on first start.
+	Enabled bool
+
+	// Labels are additional labels of the created dapr Secrets, for example
+	// so that they match the Secret selector of the controller.
+	Labels map[string]string
+
+	// HelmAdopt marks the created dapr Secrets as owned by HelmRelease, so
+	// that installing dapr with Helm adopts, rather than fails on, them. Helm
+	// then overwrites their data with that of the dapr chart, so this is off
+	// by default.
+	HelmAdopt bool
+
+	// HelmRelease is the name of the Helm release dapr is installed with.
+	// Only used if HelmAdopt is true.
+	HelmRelease string
+}
+
+// newBootstrapSecret returns the dapr Secret to create with the given name,
+// without data. The Secret carries the labels of the dapr Helm chart, and is
+// only marked as owned by the Helm release if adoption is enabled.
+func (s *secretCtrl) newBootstrapSecret(namespace, name string) corev1.Secret {
+	secret := corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels: map[string]string{
+				"app":                       "dapr-sentry",
+				"app.kubernetes.io/part-of": "dapr",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	maps.Copy(secret.Labels, s.bootstrap.Labels)
+
+	if s.bootstrap.HelmAdopt {
+		secret.Labels["app.kubernetes.io/managed-by"] = "Helm"
+		secret.Annotations = map[string]string{
+			"meta.helm.sh/release-name":      s.bootstrap.HelmRelease,
+			"meta.helm.sh/release-namespace": namespace,
+		}
+	}
+
+	return secret
+}
+
+// createBootstrapSecrets creates the dapr certificate Secret, which does not
+// exist, with the issuer and trust anchors of the update in a single write, so
+// that dapr Sentry never observes a partially written Secret. A separate dapr
+// CA Secret is created first if createCA is true, or otherwise has its trust
+// anchors patched as usual.
+func (s *secretCtrl) createBootstrapSecrets(ctx context.Context, log logr.Logger, namespace string, conf secretConf,
+	update *bundleUpdate, cmSecret corev1.Secret, daprCertSecret, daprCASecret *corev1.Secret, createCA bool, cert *cmapi.Certificate,
+) error {
+	if daprCertSecret.Data == nil {
+		daprCertSecret.Data = make(map[string][]byte)
+	}
+
+	var taPEM []byte
+	if len(conf.caSecretName) > 0 {
+		var err error
+		taPEM, err = update.trustAnchors.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal trust anchors: %w", err)
+		}
+
+		switch {
+		case conf.caSecretName == conf.certSecretName:
+			daprCertSecret.Data[conf.certSecretCAKey] = taPEM
+
+		case createCA:
+			if daprCASecret.Data == nil {
+				daprCASecret.Data = make(map[string][]byte)
+			}
+			daprCASecret.Data[conf.certSecretCAKey] = taPEM
+			log.Info("creating dapr CA certificate Secret", "secret", conf.caSecretName)
+			err := s.client.Create(ctx, daprCASecret, client.FieldOwner(fieldManager))
+			if err := s.observeWriteStep(log, namespace, conf.caSecretName, writeStepBootstrap, err, cert); err != nil {
+				return err
+			}
+			updatesTotal.WithLabelValues(namespace, conf.caSecretName).Inc()
+
+		case len(update.added) > 0 || len(update.pruned) > 0 || len(update.removed) > 0:
+			taPEM, err = s.patchTrustAnchors(ctx, conf, daprCASecret, update)
+			if err := s.observeWriteStep(log, namespace, conf.caSecretName, writeStepTrustAnchors, err, daprCASecret, cert); err != nil {
+				return err
+			}
+			updatesTotal.WithLabelValues(namespace, conf.caSecretName).Inc()
+		}
+	}
+
+	// There is no current issuer to rotate from, so the issuer is never held
+	// back for a root CA rotation.
+	daprCertSecret.Data[conf.certSectretKey] = cmSecret.Data[corev1.TLSCertKey]
+	daprCertSecret.Data[conf.certSecretPKKey] = cmSecret.Data[corev1.TLSPrivateKeyKey]
+
+	log.Info("creating dapr certificate Secret")
+	err := s.client.Create(ctx, daprCertSecret, client.FieldOwner(fieldManager))
+	if err := s.observeWriteStep(log, namespace, conf.certSecretName, writeStepBootstrap, err, cert); err != nil {
+		return err
+	}
+	updatesTotal.WithLabelValues(namespace, conf.certSecretName).Inc()
+	s.recordEvent(corev1.EventTypeNormal, reasonSecretBootstrapped,
+		fmt.Sprintf("Created dapr certificate Secret %q with the issuer of cert-manager Secret %q", conf.certSecretName, cmSecret.Name),
+		daprCertSecret, cert)
+
+	observeSync(s.clock, namespace, conf, daprCertSecret.Data[conf.certSectretKey], taPEM)
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_reconcileBundle_bootstrap(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	// The cert-manager Certificate and Secret, without the dapr Secret.
+	objs := testObjects(t, issuer, root, nil)[:2]
+
+	t.Run("missing dapr Secret is not created if bootstrapping is disabled", func(t *testing.T) {
+		s, _ := newTestSecretCtrl(t, now, objs...)
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret)
+		if !apierrors.IsNotFound(err) {
+			t.Errorf("expected dapr Secret to not exist, got %v", err)
+		}
+	})
+
+	t.Run("missing dapr Secret is created with the issuer and trust anchors", func(t *testing.T) {
+		s, recorder := newTestSecretCtrl(t, now, objs...)
+		s.bootstrap = BootstrapOptions{
+			Enabled:     true,
+			Labels:      map[string]string{"dapr-cert-manager.diagrid.io/managed": "true"},
+			HelmAdopt:   true,
+			HelmRelease: "dapr",
+		}
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+
+		for key, exp := range map[string][]byte{
+			"issuer.crt": certPEM(issuer.cert),
+			"issuer.key": keyPEM(t, issuer.key),
+			"ca.crt":     certPEM(root.cert),
+		} {
+			if !bytes.Equal(secret.Data[key], exp) {
+				t.Errorf("unexpected %s in dapr Secret", key)
+			}
+		}
+
+		for key, exp := range map[string]string{
+			"app":                                  "dapr-sentry",
+			"app.kubernetes.io/managed-by":         "Helm",
+			"dapr-cert-manager.diagrid.io/managed": "true",
+		} {
+			if secret.Labels[key] != exp {
+				t.Errorf("expected label %s=%s, got %q", key, exp, secret.Labels[key])
+			}
+		}
+		if secret.Annotations["meta.helm.sh/release-name"] != "dapr" || secret.Annotations["meta.helm.sh/release-namespace"] != "dapr-system" {
+			t.Errorf("unexpected Helm annotations: %v", secret.Annotations)
+		}
+
+		if events := strings.Join(drainEvents(recorder), "\n"); !strings.Contains(events, reasonSecretBootstrapped) {
+			t.Errorf("expected %s event, got %q", reasonSecretBootstrapped, events)
+		}
+
+		// The created Secret is reconciled as usual afterwards.
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("missing dapr Secret is not marked as owned by Helm unless adoption is enabled", func(t *testing.T) {
+		s, _ := newTestSecretCtrl(t, now, objs...)
+		s.bootstrap = BootstrapOptions{Enabled: true, HelmRelease: "dapr"}
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := secret.Labels["app.kubernetes.io/managed-by"]; ok || len(secret.Annotations) > 0 {
+			t.Errorf("expected no Helm ownership, got labels %v and annotations %v", secret.Labels, secret.Annotations)
+		}
+	})
+}
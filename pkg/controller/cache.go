@@ -0,0 +1,435 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// CacheOptions configure the cache of the Manager.
+type CacheOptions struct {
+	// Namespaces are the dapr namespaces objects are cached in. If empty, the
+	// cache is cluster wide, since namespaces selected by label are not known
+	// ahead of time.
+	Namespaces []string
+
+	// SecretNames are the names of the only Secrets which are cached in each
+	// namespace: the source cert-manager Secrets and the target dapr Secrets.
+	// Each name is listed and watched with its own field selector, so that
+	// list and watch of Secrets can be restricted by name with RBAC.
+	SecretNames []string
+
+	// SecretSelector optionally further restricts the cached Secrets by label.
+	SecretSelector labels.Selector
+}
+
+// NewCache returns the function which creates the cache of the Manager. Only
+// the Secrets with the given names are cached, in full.
+func NewCache(opts CacheOptions) cache.NewCacheFunc {
+	return func(config *rest.Config, o cache.Options) (cache.Cache, error) {
+		if len(opts.Namespaces) > 0 {
+			o.DefaultNamespaces = make(map[string]cache.Config)
+			for _, namespace := range opts.Namespaces {
+				o.DefaultNamespaces[namespace] = cache.Config{}
+			}
+		}
+
+		// Only the dapr system Configuration is cached, so that list and watch
+		// of Configurations can be restricted by name with RBAC. The
+		// Configuration is not cached if its resource is not served.
+		served, err := daprConfigurationServed(o.Mapper)
+		if err != nil {
+			return nil, err
+		}
+		if served {
+			o.ByObject = maps.Clone(o.ByObject)
+			if o.ByObject == nil {
+				o.ByObject = make(map[client.Object]cache.ByObject)
+			}
+			o.ByObject[newDaprSystemConfiguration()] = cache.ByObject{
+				Field: fields.OneTermEqualSelector("metadata.name", daprSystemConfigurationName),
+			}
+		}
+
+		c, err := cache.New(config, cloneCacheOptions(o))
+		if err != nil {
+			return nil, err
+		}
+
+		sc := &secretNameCache{Cache: c, scheme: o.Scheme, secrets: make(map[string]cache.Cache)}
+		for _, name := range opts.SecretNames {
+			so := cloneCacheOptions(o)
+			so.DefaultFieldSelector = fields.OneTermEqualSelector("metadata.name", name)
+			so.DefaultLabelSelector = opts.SecretSelector
+			if sc.secrets[name], err = cache.New(config, so); err != nil {
+				return nil, fmt.Errorf("failed to create cache of Secret %q: %w", name, err)
+			}
+		}
+
+		return sc, nil
+	}
+}
+
+// cloneCacheOptions returns a copy of the given cache options which can be
+// passed to cache.New, which defaults the namespace and object maps in place.
+func cloneCacheOptions(o cache.Options) cache.Options {
+	o.DefaultNamespaces = maps.Clone(o.DefaultNamespaces)
+	o.ByObject = maps.Clone(o.ByObject)
+	return o
+}
+
+// secretNameCache is a cache which serves Secrets from a separate cache for
+// each Secret name, and all other objects from the embedded cache.
+type secretNameCache struct {
+	cache.Cache
+	scheme  *runtime.Scheme
+	secrets map[string]cache.Cache
+}
+
+// isSecret returns true if the given object, or list, is of Secrets. Secret
+// metadata objects are also Secrets.
+func (c *secretNameCache) isSecret(obj runtime.Object) (bool, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return false, err
+	}
+	return isSecretKind(gvk), nil
+}
+
+func isSecretKind(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == corev1.GroupName && strings.TrimSuffix(gvk.Kind, "List") == "Secret"
+}
+
+func (c *secretNameCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if ok, err := c.isSecret(obj); err != nil || !ok {
+		return c.Cache.Get(ctx, key, obj, opts...)
+	}
+
+	sc, ok := c.secrets[key.Name]
+	if !ok {
+		return fmt.Errorf("refusing to read Secret %q which is not cached, only Secrets named %v are cached", key, c.secretNames())
+	}
+	return sc.Get(ctx, key, obj, opts...)
+}
+
+func (c *secretNameCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if ok, err := c.isSecret(list); err != nil || !ok {
+		return c.Cache.List(ctx, list, opts...)
+	}
+
+	var items []runtime.Object
+	for _, sc := range c.secrets {
+		l, ok := list.DeepCopyObject().(client.ObjectList)
+		if !ok {
+			return fmt.Errorf("unexpected list type %T", list)
+		}
+		if err := sc.List(ctx, l, opts...); err != nil {
+			return err
+		}
+		objs, err := apimeta.ExtractList(l)
+		if err != nil {
+			return err
+		}
+		items = append(items, objs...)
+	}
+
+	return apimeta.SetList(list, items)
+}
+
+func (c *secretNameCache) GetInformer(ctx context.Context, obj client.Object, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	if ok, err := c.isSecret(obj); err != nil || !ok {
+		return c.Cache.GetInformer(ctx, obj, opts...)
+	}
+
+	informers := make(secretInformer)
+	for name, sc := range c.secrets {
+		informer, err := sc.GetInformer(ctx, obj, opts...)
+		if err != nil {
+			return nil, err
+		}
+		informers[name] = informer
+	}
+	return informers, nil
+}
+
+func (c *secretNameCache) GetInformerForKind(ctx context.Context, gvk schema.GroupVersionKind, opts ...cache.InformerGetOption) (cache.Informer, error) {
+	if !isSecretKind(gvk) {
+		return c.Cache.GetInformerForKind(ctx, gvk, opts...)
+	}
+
+	informers := make(secretInformer)
+	for name, sc := range c.secrets {
+		informer, err := sc.GetInformerForKind(ctx, gvk, opts...)
+		if err != nil {
+			return nil, err
+		}
+		informers[name] = informer
+	}
+	return informers, nil
+}
+
+func (c *secretNameCache) RemoveInformer(ctx context.Context, obj client.Object) error {
+	if ok, err := c.isSecret(obj); err != nil || !ok {
+		return c.Cache.RemoveInformer(ctx, obj)
+	}
+
+	for _, sc := range c.secrets {
+		if err := sc.RemoveInformer(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *secretNameCache) IndexField(ctx context.Context, obj client.Object, field string, extractValue client.IndexerFunc) error {
+	if ok, err := c.isSecret(obj); err != nil || !ok {
+		return c.Cache.IndexField(ctx, obj, field, extractValue)
+	}
+
+	for _, sc := range c.secrets {
+		if err := sc.IndexField(ctx, obj, field, extractValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start starts all caches, blocking until the context is cancelled or a cache
+// fails to start.
+func (c *secretNameCache) Start(ctx context.Context) error {
+	errCh := make(chan error, len(c.secrets)+1)
+	start := func(sc cache.Cache) { errCh <- sc.Start(ctx) }
+
+	go start(c.Cache)
+	for _, sc := range c.secrets {
+		go start(sc)
+	}
+
+	for range len(c.secrets) + 1 {
+		if err := <-errCh; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *secretNameCache) WaitForCacheSync(ctx context.Context) bool {
+	for _, sc := range c.secrets {
+		if !sc.WaitForCacheSync(ctx) {
+			return false
+		}
+	}
+	return c.Cache.WaitForCacheSync(ctx)
+}
+
+// secretNames returns the sorted names of the cached Secrets.
+func (c *secretNameCache) secretNames() []string {
+	names := make([]string, 0, len(c.secrets))
+	for name := range c.secrets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// secretInformer is the informer of the Secrets of a secretNameCache, which
+// fans out to the informer of each Secret name.
+type secretInformer map[string]cache.Informer
+
+// secretRegistration is the event handler registration of a secretInformer.
+type secretRegistration map[string]toolscache.ResourceEventHandlerRegistration
+
+func (r secretRegistration) HasSynced() bool {
+	for _, reg := range r {
+		if !reg.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i secretInformer) AddEventHandler(handler toolscache.ResourceEventHandler) (toolscache.ResourceEventHandlerRegistration, error) {
+	regs := make(secretRegistration)
+	for name, informer := range i {
+		reg, err := informer.AddEventHandler(handler)
+		if err != nil {
+			return nil, err
+		}
+		regs[name] = reg
+	}
+	return regs, nil
+}
+
+func (i secretInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, resyncPeriod time.Duration) (toolscache.ResourceEventHandlerRegistration, error) {
+	regs := make(secretRegistration)
+	for name, informer := range i {
+		reg, err := informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+		if err != nil {
+			return nil, err
+		}
+		regs[name] = reg
+	}
+	return regs, nil
+}
+
+func (i secretInformer) RemoveEventHandler(handle toolscache.ResourceEventHandlerRegistration) error {
+	regs, ok := handle.(secretRegistration)
+	if !ok {
+		return fmt.Errorf("unexpected event handler registration %T", handle)
+	}
+	for name, informer := range i {
+		if reg, ok := regs[name]; ok {
+			if err := informer.RemoveEventHandler(reg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i secretInformer) AddIndexers(indexers toolscache.Indexers) error {
+	for _, informer := range i {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i secretInformer) HasSynced() bool {
+	for _, informer := range i {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i secretInformer) IsStopped() bool {
+	for _, informer := range i {
+		if informer.IsStopped() {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSecretNames returns an error if any Secret which the trust-bundle
+// controller reads in the managed dapr namespaces is not one of the cached
+// Secret names: the cert-manager Secrets of the watched Certificates, and the
+// dapr Secrets of the trust bundle, JWT and DaprCertificateBindings. Reading
+// any other Secret would fail on every reconcile. The given reader must not be
+// the cache, which is not yet started.
+func CheckSecretNames(ctx context.Context, reader client.Reader, opts Options, secretNames []string) error {
+	secCtl, err := newSecretCtrl(opts)
+	if err != nil {
+		return err
+	}
+	secCtl.lister = reader
+
+	namespaces, err := secCtl.managedNamespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list managed dapr namespaces: %w", err)
+	}
+	slices.Sort(namespaces)
+
+	var missing []string
+	for _, namespace := range namespaces {
+		secrets, err := secCtl.readSecrets(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		for _, secret := range secrets {
+			if !slices.Contains(secretNames, secret.name) {
+				missing = append(missing, fmt.Sprintf("%s/%s (%s)", namespace, secret.name, secret.of))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the Secrets %s are not cached, add their names to --secret-names (helm value app.secretNames); only Secrets named %v are cached",
+			strings.Join(missing, ", "), secretNames)
+	}
+	return nil
+}
+
+// readSecret is a Secret which is read by the trust-bundle controller.
+type readSecret struct {
+	name string
+	// of describes what the Secret is read for.
+	of string
+}
+
+// readSecrets returns the Secrets which the trust-bundle controller reads in
+// the given dapr namespace, ordered by name. The cert-manager Secrets are
+// those of the spec.secretName of the existing Certificates, or of the
+// Certificates which would be provisioned.
+func (s *secretCtrl) readSecrets(ctx context.Context, namespace string) ([]readSecret, error) {
+	secrets := make(map[string]string)
+	add := func(name, of string) {
+		if _, ok := secrets[name]; !ok && len(name) > 0 {
+			secrets[name] = of
+		}
+	}
+
+	certSecret := func(certName string, provision bool) error {
+		var cert cmapi.Certificate
+		err := s.lister.Get(ctx, client.ObjectKey{Namespace: namespace, Name: certName}, &cert)
+		switch {
+		case err == nil:
+			add(cert.Spec.SecretName, fmt.Sprintf("cert-manager Secret of Certificate %q", certName))
+		case apierrors.IsNotFound(err) && provision:
+			add(provisionedSecretName(certName), fmt.Sprintf("cert-manager Secret of provisioned Certificate %q", certName))
+		case !apierrors.IsNotFound(err):
+			return fmt.Errorf("failed to get Certificate %s/%s: %w", namespace, certName, err)
+		}
+		return nil
+	}
+
+	confs, err := s.secretConfs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, conf := range confs {
+		add(conf.certSecretName, fmt.Sprintf("dapr Secret of Certificate %q", conf.certName))
+		add(conf.caSecretName, fmt.Sprintf("dapr CA Secret of Certificate %q", conf.certName))
+		if err := certSecret(conf.certName, conf.provision); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.jwtCertName) > 0 {
+		add(jwtSecretName, "dapr JWT Secret")
+		if err := certSecret(s.jwtCertName, false); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.truststores.enabled() {
+		add(s.truststores.PasswordSecretName, "truststore password Secret")
+	}
+
+	names := slices.Sorted(maps.Keys(secrets))
+	read := make([]readSecret, 0, len(names))
+	for _, name := range names {
+		read = append(read, readSecret{name: name, of: secrets[name]})
+	}
+	return read, nil
+}
@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+)
+
+// secretAPIServer serves list and watch of the given Secrets in the
+// dapr-system namespace, honouring field and label selectors. Watches never
+// return any events.
+func secretAPIServer(t testing.TB, secrets []corev1.Secret) (*rest.Config, cache.Options) {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/dapr-system/secrets" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		if query.Get("watch") == "true" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+
+		fieldSelector, err := fields.ParseSelector(query.Get("fieldSelector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		labelSelector, err := labels.Parse(query.Get("labelSelector"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var items []corev1.Secret
+		for _, secret := range secrets {
+			if fieldSelector.Matches(fields.Set{"metadata.name": secret.Name, "metadata.namespace": secret.Namespace}) &&
+				labelSelector.Matches(labels.Set(secret.Labels)) {
+				items = append(items, secret)
+			}
+		}
+
+		var list any = &corev1.SecretList{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "SecretList"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+			Items:    items,
+		}
+		if strings.Contains(r.Header.Get("Accept"), "as=PartialObjectMetadataList") {
+			metaList := &metav1.PartialObjectMetadataList{
+				TypeMeta: metav1.TypeMeta{APIVersion: "meta.k8s.io/v1", Kind: "PartialObjectMetadataList"},
+				ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+			}
+			for i := range items {
+				metaList.Items = append(metaList.Items, *meta.AsPartialObjectMetadata(&items[i]))
+			}
+			list = metaList
+		}
+
+		if err := json.NewEncoder(w).Encode(list); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("SecretList"), meta.RESTScopeNamespace)
+
+	return &rest.Config{Host: srv.URL, ContentConfig: rest.ContentConfig{ContentType: "application/json"}},
+		cache.Options{Scheme: clientgoscheme.Scheme, Mapper: mapper}
+}
+
+// testSecrets returns the given number of Secrets in the dapr-system
+// namespace, each with data of the given size.
+func testSecrets(t testing.TB, num, dataSize int) []corev1.Secret {
+	t.Helper()
+
+	secrets := make([]corev1.Secret, num)
+	for i := range secrets {
+		data := make([]byte, dataSize)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatal(err)
+		}
+		secrets[i] = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "dapr-system",
+				Name:            fmt.Sprintf("secret-%d", i),
+				ResourceVersion: "1",
+				Labels:          map[string]string{"app": "workload"},
+			},
+			Data: map[string][]byte{"tls.crt": data},
+		}
+	}
+
+	return secrets
+}
+
+func Test_NewCache(t *testing.T) {
+	secrets := testSecrets(t, 10, 16)
+	config, o := secretAPIServer(t, secrets)
+
+	c, err := NewCache(CacheOptions{
+		Namespaces:  []string{"dapr-system"},
+		SecretNames: []string{"secret-1", "secret-2"},
+	})(config, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		if err := c.Start(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	if _, err := c.GetInformer(ctx, new(corev1.Secret)); err != nil {
+		t.Fatal(err)
+	}
+	if !c.WaitForCacheSync(ctx) {
+		t.Fatal("cache failed to sync")
+	}
+
+	var list corev1.SecretList
+	if err := c.List(ctx, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 2 {
+		t.Errorf("expected only the 2 named Secrets to be cached, got %d", len(list.Items))
+	}
+
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "dapr-system", Name: "secret-2"}, &secret); err != nil {
+		t.Errorf("expected named Secret to be read from the cache: %s", err)
+	}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: "dapr-system", Name: "secret-3"}, &secret); err == nil {
+		t.Error("expected reading a Secret which is not named to fail")
+	}
+}
+
+func Test_CheckSecretNames(t *testing.T) {
+	scheme := apiruntime.NewScheme()
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+			Spec:       cmapi.CertificateSpec{SecretName: "my-issuer"},
+		},
+		&cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "app"},
+			Spec:       cmapi.CertificateSpec{SecretName: "app-issuer"},
+		},
+		&v1alpha1.DaprCertificateBinding{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "app"},
+			Spec: v1alpha1.DaprCertificateBindingSpec{
+				CertificateName: "app",
+				Target:          v1alpha1.DaprCertificateBindingTarget{SecretName: "app-secret"},
+			},
+		},
+	).Build()
+
+	tests := map[string]struct {
+		opts        Options
+		secretNames []string
+		expMissing  []string
+	}{
+		"all Secrets which are read are cached": {
+			opts:        Options{TrustBundleCertificateName: "dapr-trust-bundle", CertificateBindingsEnabled: true},
+			secretNames: []string{"app-issuer", "app-secret", "dapr-trust-bundle", "my-issuer"},
+		},
+		"cert-manager Secret of the trust bundle Certificate is not cached": {
+			opts:        Options{TrustBundleCertificateName: "dapr-trust-bundle"},
+			secretNames: []string{"dapr-trust-bundle", "dapr-trust-bundle-from-cert-manager"},
+			expMissing:  []string{"dapr-system/my-issuer"},
+		},
+		"source and target Secrets of bindings are not cached": {
+			opts:        Options{TrustBundleCertificateName: "dapr-trust-bundle", CertificateBindingsEnabled: true},
+			secretNames: []string{"dapr-trust-bundle", "my-issuer"},
+			expMissing:  []string{"dapr-system/app-issuer", "dapr-system/app-secret"},
+		},
+		"cert-manager Secret of a Certificate which would be provisioned is not cached": {
+			opts: Options{
+				TrustBundleCertificateName: "dapr-provisioned",
+				Provision:                  ProvisionOptions{Enabled: true},
+			},
+			secretNames: []string{"dapr-trust-bundle"},
+			expMissing:  []string{"dapr-system/dapr-provisioned-from-cert-manager"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.opts.DaprNamespaces = []string{"dapr-system"}
+			err := CheckSecretNames(context.Background(), cl, test.opts, test.secretNames)
+			if len(test.expMissing) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected error for missing Secrets %v", test.expMissing)
+			}
+			for _, missing := range test.expMissing {
+				if !strings.Contains(err.Error(), missing) {
+					t.Errorf("expected error to contain missing Secret %q: %s", missing, err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSecretCache compares the memory retained by the cache of a dapr
+// namespace containing thousands of Secrets, when caching all full Secrets,
+// the metadata of all Secrets, and the full managed Secrets by name as
+// NewCache does.
+func BenchmarkSecretCache(b *testing.B) {
+	const (
+		numSecrets = 5000
+		dataSize   = 4096
+	)
+
+	secrets := testSecrets(b, numSecrets, dataSize)
+	config, o := secretAPIServer(b, secrets)
+
+	allSecrets := func(config *rest.Config, o cache.Options) (cache.Cache, error) {
+		o.DefaultNamespaces = map[string]cache.Config{"dapr-system": {}}
+		return cache.New(config, o)
+	}
+	secretMetadata := &metav1.PartialObjectMetadata{}
+	secretMetadata.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+
+	tests := map[string]struct {
+		newCache cache.NewCacheFunc
+		obj      client.Object
+	}{
+		"full Secrets": {
+			newCache: allSecrets,
+			obj:      new(corev1.Secret),
+		},
+		"Secret metadata": {
+			newCache: allSecrets,
+			obj:      secretMetadata,
+		},
+		"managed Secrets by name": {
+			newCache: NewCache(CacheOptions{
+				Namespaces:  []string{"dapr-system"},
+				SecretNames: []string{"secret-0", "secret-1"},
+			}),
+			obj: new(corev1.Secret),
+		},
+	}
+
+	for name, test := range tests {
+		b.Run(name, func(b *testing.B) {
+			var retained uint64
+			for n := 0; n < b.N; n++ {
+				before := heapInUse()
+
+				c, err := test.newCache(config, o)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ctx, cancel := context.WithCancel(context.Background())
+				go func() {
+					if err := c.Start(ctx); err != nil {
+						b.Error(err)
+					}
+				}()
+				if _, err := c.GetInformer(ctx, test.obj); err != nil {
+					b.Fatal(err)
+				}
+				if !c.WaitForCacheSync(ctx) {
+					b.Fatal("cache failed to sync")
+				}
+
+				after := heapInUse()
+				if after > before {
+					retained += after - before
+				}
+				runtime.KeepAlive(c)
+				cancel()
+			}
+
+			b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+		})
+	}
+}
+
+// heapInUse returns the bytes of heap in use after a garbage collection.
+func heapInUse() uint64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
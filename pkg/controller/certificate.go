@@ -0,0 +1,73 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// parseCertificates parses all PEM encoded certificates from the given bytes.
+// Returns an error if no certificates could be found.
+func parseCertificates(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	return certs, nil
+}
+
+// chainsTo returns true if the given certificate chain is signed by, or
+// contains, the given trust anchor. The chain is expected to be ordered leaf
+// first, as is the case with the `tls.crt` written by cert-manager.
+// Expiry is not taken into account.
+func chainsTo(chain []*x509.Certificate, anchor *x509.Certificate) bool {
+	for i, cert := range chain {
+		if cert.Equal(anchor) || cert.CheckSignatureFrom(anchor) == nil {
+			return true
+		}
+		if i+1 < len(chain) && cert.CheckSignatureFrom(chain[i+1]) != nil {
+			// The chain is broken, so can't chain to the anchor.
+			return false
+		}
+	}
+	return false
+}
+
+// fingerprint returns the hex encoded SHA-256 fingerprint of the given
+// certificate.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// certificateLogValues returns the key value pairs used to identify a
+// certificate in log lines.
+func certificateLogValues(cert *x509.Certificate) []any {
+	return []any{
+		"subject", cert.Subject.String(),
+		"serial", cert.SerialNumber.String(),
+		"fingerprint", fingerprint(cert),
+		"not_after", cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate and private key used for signing in tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// genCA generates a CA certificate valid between notBefore and notAfter. If
+// parent is nil, the certificate is self-signed.
+func genCA(t *testing.T, cn string, parent *testCA, notBefore, notAfter time.Time) *testCA {
+	t.Helper()
+	return genCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}, parent)
+}
+
+// genCert generates a certificate from the given template. If parent is nil,
+// the certificate is self-signed.
+func genCert(t *testing.T, tmpl *x509.Certificate, parent *testCA) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parentCert, parentKey := tmpl, crypto.Signer(key)
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key}
+}
+
+// certPEM returns the PEM encoding of the given certificates.
+func certPEM(certs ...*x509.Certificate) []byte {
+	var b []byte
+	for _, cert := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return b
+}
+
+// keyPEM returns the PKCS#8 PEM encoding of the given private key.
+func keyPEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func Test_chainsTo(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	otherRoot := genCA(t, "other-root", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	intermediate := genCA(t, "intermediate", root, now.Add(-time.Hour), now.Add(time.Hour))
+	issuer := genCA(t, "issuer", intermediate, now.Add(-time.Hour), now.Add(time.Hour))
+
+	tests := map[string]struct {
+		chain  []*x509.Certificate
+		anchor *x509.Certificate
+		exp    bool
+	}{
+		"empty chain": {
+			chain:  nil,
+			anchor: root.cert,
+			exp:    false,
+		},
+		"issuer signed directly by anchor": {
+			chain:  []*x509.Certificate{intermediate.cert},
+			anchor: root.cert,
+			exp:    true,
+		},
+		"issuer signed via intermediate": {
+			chain:  []*x509.Certificate{issuer.cert, intermediate.cert},
+			anchor: root.cert,
+			exp:    true,
+		},
+		"chain includes anchor": {
+			chain:  []*x509.Certificate{issuer.cert, intermediate.cert, root.cert},
+			anchor: root.cert,
+			exp:    true,
+		},
+		"chain missing intermediate": {
+			chain:  []*x509.Certificate{issuer.cert},
+			anchor: root.cert,
+			exp:    false,
+		},
+		"different anchor": {
+			chain:  []*x509.Certificate{issuer.cert, intermediate.cert},
+			anchor: otherRoot.cert,
+			exp:    false,
+		},
+		"broken chain": {
+			chain:  []*x509.Certificate{issuer.cert, otherRoot.cert},
+			anchor: root.cert,
+			exp:    false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := chainsTo(test.chain, test.anchor); got != test.exp {
+				t.Errorf("unexpected chainsTo result, exp=%t got=%t", test.exp, got)
+			}
+		})
+	}
+}
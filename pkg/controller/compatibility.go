@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// daprSystemConfigurationName is the name of the dapr Configuration which
+	// configures the dapr control plane.
+	daprSystemConfigurationName = "daprsystem"
+
+	// defaultControlPlaneTrustDomain is the trust domain of the dapr control
+	// plane if not set in the dapr system Configuration.
+	defaultControlPlaneTrustDomain = "cluster.local"
+
+	// defaultAppTrustDomain is the trust domain of dapr applications which don't
+	// set a trust domain in their Configuration.
+	defaultAppTrustDomain = "public"
+
+	// defaultWorkloadCertTTL is the TTL of workload certificates issued by dapr
+	// Sentry if not set in the dapr system Configuration.
+	defaultWorkloadCertTTL = time.Hour * 24
+
+	// minRSAKeySize is the minimum RSA key size accepted for the issuer.
+	minRSAKeySize = 2048
+)
+
+// daprConfigurationGVK is the GroupVersionKind of the dapr Configuration
+// resource.
+var daprConfigurationGVK = schema.GroupVersionKind{
+	Group:   "dapr.io",
+	Version: "v1alpha1",
+	Kind:    "Configuration",
+}
+
+// daprSystemConfig is the subset of the dapr system Configuration which is
+// relevant to the issuer certificate used by dapr Sentry.
+type daprSystemConfig struct {
+	// trustDomains are the SPIFFE trust domains which the issuer must be
+	// permitted to issue workload certificates for.
+	trustDomains []string
+
+	// workloadCertTTL is the TTL of workload certificates issued by Sentry.
+	workloadCertTTL time.Duration
+}
+
+// defaultDaprSystemConfig returns the dapr system Configuration defaults.
+func defaultDaprSystemConfig() daprSystemConfig {
+	return daprSystemConfig{
+		trustDomains:    []string{defaultControlPlaneTrustDomain, defaultAppTrustDomain},
+		workloadCertTTL: defaultWorkloadCertTTL,
+	}
+}
+
+// daprConfigurationServed returns true if the dapr Configuration resource is
+// served by the API server.
+func daprConfigurationServed(mapper meta.RESTMapper) (bool, error) {
+	_, err := mapper.RESTMapping(daprConfigurationGVK.GroupKind(), daprConfigurationGVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to discover dapr Configuration resource: %w", err)
+	}
+	return true, nil
+}
+
+// newDaprSystemConfiguration returns an empty dapr Configuration object, used
+// to configure the cache and watch of the dapr system Configuration.
+func newDaprSystemConfiguration() *unstructured.Unstructured {
+	var obj unstructured.Unstructured
+	obj.SetGroupVersionKind(daprConfigurationGVK)
+	return &obj
+}
+
+// getDaprSystemConfig fetches the dapr system Configuration from the given
+// namespace. If the reader is nil, or the Configuration or its
+// CustomResourceDefinition does not exist, then the dapr defaults are
+// returned.
+func getDaprSystemConfig(ctx context.Context, reader client.Reader, namespace string) (daprSystemConfig, error) {
+	conf := defaultDaprSystemConfig()
+	if reader == nil {
+		return conf, nil
+	}
+
+	obj := newDaprSystemConfiguration()
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: daprSystemConfigurationName}, obj)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return conf, nil
+	}
+	if err != nil {
+		return conf, fmt.Errorf("failed to get dapr Configuration %s/%s: %w", namespace, daprSystemConfigurationName, err)
+	}
+
+	ttl, _, err := unstructured.NestedString(obj.Object, "spec", "mtls", "workloadCertTTL")
+	if err != nil {
+		return conf, fmt.Errorf("failed to read workloadCertTTL from dapr Configuration: %w", err)
+	}
+	if len(ttl) > 0 {
+		conf.workloadCertTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			return conf, fmt.Errorf("failed to parse workloadCertTTL %q from dapr Configuration: %w", ttl, err)
+		}
+	}
+
+	td, _, err := unstructured.NestedString(obj.Object, "spec", "mtls", "controlPlaneTrustDomain")
+	if err != nil {
+		return conf, fmt.Errorf("failed to read controlPlaneTrustDomain from dapr Configuration: %w", err)
+	}
+	if len(td) > 0 {
+		conf.trustDomains[0] = td
+	}
+
+	return conf, nil
+}
+
+// validateDaprCompatibility validates that the issuer certificate chain is
+// accepted by dapr Sentry, and that Sentry is able to use it to issue
+// workload certificates. The issuer key algorithm must be supported, the path
+// length constraints of the issuer and its parents must allow for the issuer
+// to sign leaf certificates, name constraints must permit the dapr trust
+// domains, and the issuer must outlive the workload certificate TTL.
+// All failed checks are returned as a validationError.
+func validateDaprCompatibility(certPEM []byte, trustAnchors *x509bundle.Bundle, conf daprSystemConfig, now time.Time) error {
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return &validationError{err: fmt.Errorf("failed to parse issuer certificate: %w", err)}
+	}
+	issuer := chain[0]
+
+	var errs []error
+	if err := validateKeyAlgorithm(issuer); err != nil {
+		errs = append(errs, err)
+	}
+
+	// The path from the issuer up to, and including, the trust anchor.
+	path := chain
+	if trustAnchors != nil {
+		path = pathToTrustAnchor(chain, trustAnchors)
+	}
+
+	for i, cert := range path {
+		// The number of CA certificates which are beneath this certificate in
+		// the path, when the issuer is signing a leaf workload certificate.
+		if hasMaxPathLen(cert) && cert.MaxPathLen < i {
+			errs = append(errs, fmt.Errorf("certificate %q has a max path length of %d which does not allow the issuer to sign workload certificates", cert.Subject, cert.MaxPathLen))
+		}
+
+		for _, td := range conf.trustDomains {
+			if !uriDomainPermitted(cert, td) {
+				errs = append(errs, fmt.Errorf("certificate %q name constraints do not permit the dapr trust domain %q", cert.Subject, td))
+			}
+		}
+	}
+
+	if remaining := issuer.NotAfter.Sub(now); remaining <= conf.workloadCertTTL {
+		errs = append(errs, fmt.Errorf("issuer certificate remaining lifetime %s is not longer than the dapr workload certificate TTL %s",
+			remaining.Truncate(time.Second), conf.workloadCertTTL))
+	}
+
+	if len(errs) > 0 {
+		return &validationError{err: errors.Join(errs...)}
+	}
+
+	return nil
+}
+
+// validateKeyAlgorithm returns an error if the public key algorithm of the
+// given certificate is not supported by dapr Sentry.
+func validateKeyAlgorithm(cert *x509.Certificate) error {
+	switch pub := cert.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return nil
+		default:
+			return fmt.Errorf("issuer certificate ECDSA curve %s is not supported", pub.Curve.Params().Name)
+		}
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeySize {
+			return fmt.Errorf("issuer certificate RSA key size %d is smaller than the minimum %d", pub.N.BitLen(), minRSAKeySize)
+		}
+		return nil
+	case ed25519.PublicKey:
+		return nil
+	default:
+		return fmt.Errorf("issuer certificate public key algorithm %s is not supported", cert.PublicKeyAlgorithm)
+	}
+}
+
+// pathToTrustAnchor returns the certificate path from the issuer up to, and
+// including, the first trust anchor which the chain chains to. If the chain
+// doesn't chain to any trust anchor, the chain is returned as is.
+func pathToTrustAnchor(chain []*x509.Certificate, trustAnchors *x509bundle.Bundle) []*x509.Certificate {
+	for _, anchor := range trustAnchors.X509Authorities() {
+		if !chainsTo(chain, anchor) {
+			continue
+		}
+		for i, cert := range chain {
+			if cert.Equal(anchor) {
+				return chain[:i+1]
+			}
+			if cert.CheckSignatureFrom(anchor) == nil {
+				return append(append([]*x509.Certificate{}, chain[:i+1]...), anchor)
+			}
+		}
+	}
+	return chain
+}
+
+// hasMaxPathLen returns true if the given certificate has a path length
+// constraint.
+func hasMaxPathLen(cert *x509.Certificate) bool {
+	return cert.BasicConstraintsValid && (cert.MaxPathLen > 0 || cert.MaxPathLenZero)
+}
+
+// uriDomainPermitted returns true if the URI name constraints of the given
+// certificate permit the given domain, following the semantics of RFC 5280
+// where a constraint with a leading period matches any subdomain.
+func uriDomainPermitted(cert *x509.Certificate, domain string) bool {
+	for _, excluded := range cert.ExcludedURIDomains {
+		if matchURIDomain(excluded, domain) {
+			return false
+		}
+	}
+
+	if len(cert.PermittedURIDomains) == 0 {
+		return true
+	}
+
+	for _, permitted := range cert.PermittedURIDomains {
+		if matchURIDomain(permitted, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchURIDomain returns true if the domain matches the URI domain constraint.
+func matchURIDomain(constraint, domain string) bool {
+	constraint, domain = strings.ToLower(constraint), strings.ToLower(domain)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(domain, constraint)
+	}
+	return constraint == domain
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_getDaprSystemConfig(t *testing.T) {
+	t.Run("no Configuration should return defaults", func(t *testing.T) {
+		conf, err := getDaprSystemConfig(context.Background(), fake.NewClientBuilder().Build(), "dapr-system")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.workloadCertTTL != defaultWorkloadCertTTL {
+			t.Errorf("unexpected workload cert TTL, exp=%s got=%s", defaultWorkloadCertTTL, conf.workloadCertTTL)
+		}
+		if conf.trustDomains[0] != defaultControlPlaneTrustDomain {
+			t.Errorf("unexpected trust domain, exp=%s got=%s", defaultControlPlaneTrustDomain, conf.trustDomains[0])
+		}
+	})
+
+	t.Run("no reader should return defaults", func(t *testing.T) {
+		conf, err := getDaprSystemConfig(context.Background(), nil, "dapr-system")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.workloadCertTTL != defaultWorkloadCertTTL {
+			t.Errorf("unexpected workload cert TTL, exp=%s got=%s", defaultWorkloadCertTTL, conf.workloadCertTTL)
+		}
+	})
+
+	t.Run("Configuration should override defaults", func(t *testing.T) {
+		var obj unstructured.Unstructured
+		obj.SetGroupVersionKind(daprConfigurationGVK)
+		obj.SetNamespace("dapr-system")
+		obj.SetName(daprSystemConfigurationName)
+		if err := unstructured.SetNestedField(obj.Object, "1h", "spec", "mtls", "workloadCertTTL"); err != nil {
+			t.Fatal(err)
+		}
+		if err := unstructured.SetNestedField(obj.Object, "example.com", "spec", "mtls", "controlPlaneTrustDomain"); err != nil {
+			t.Fatal(err)
+		}
+
+		conf, err := getDaprSystemConfig(context.Background(), fake.NewClientBuilder().WithObjects(&obj).Build(), "dapr-system")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conf.workloadCertTTL != time.Hour {
+			t.Errorf("unexpected workload cert TTL, exp=%s got=%s", time.Hour, conf.workloadCertTTL)
+		}
+		if conf.trustDomains[0] != "example.com" {
+			t.Errorf("unexpected trust domain, exp=example.com got=%s", conf.trustDomains[0])
+		}
+	})
+}
+
+func Test_validateDaprCompatibility(t *testing.T) {
+	now := time.Now()
+	conf := daprSystemConfig{
+		trustDomains:    []string{defaultControlPlaneTrustDomain, defaultAppTrustDomain},
+		workloadCertTTL: time.Hour,
+	}
+
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*24))
+	shortIssuer := genCA(t, "short-issuer", root, now.Add(-time.Hour), now.Add(time.Minute*30))
+
+	pathLenZeroRoot := genCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "path-len-zero-root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour * 48),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	pathLenZeroIssuer := genCA(t, "path-len-zero-issuer", pathLenZeroRoot, now.Add(-time.Hour), now.Add(time.Hour*24))
+
+	constrainedRoot := genCert(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "constrained-root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour * 48),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		PermittedURIDomains:   []string{"example.com"},
+	}, nil)
+	constrainedIssuer := genCA(t, "constrained-issuer", constrainedRoot, now.Add(-time.Hour), now.Add(time.Hour*24))
+
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224Tmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "p224-issuer"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour * 24),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		SerialNumber:          issuer.cert.SerialNumber,
+	}
+	p224DER, err := x509.CreateCertificate(rand.Reader, p224Tmpl, root.cert, p224Key.Public(), root.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p224Issuer, err := x509.ParseCertificate(p224DER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := func(certs ...*x509.Certificate) *x509bundle.Bundle {
+		return x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, certs)
+	}
+
+	tests := map[string]struct {
+		cert         []byte
+		trustAnchors *x509bundle.Bundle
+		expErr       bool
+	}{
+		"compatible issuer should not error": {
+			cert:         certPEM(issuer.cert),
+			trustAnchors: bundle(root.cert),
+			expErr:       false,
+		},
+		"unsupported curve should error": {
+			cert:         certPEM(p224Issuer),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+		"root path length zero should error": {
+			cert:         certPEM(pathLenZeroIssuer.cert),
+			trustAnchors: bundle(pathLenZeroRoot.cert),
+			expErr:       true,
+		},
+		"issuer path length zero should not error": {
+			cert:         certPEM(pathLenZeroRoot.cert),
+			trustAnchors: bundle(pathLenZeroRoot.cert),
+			expErr:       false,
+		},
+		"name constraints not permitting trust domain should error": {
+			cert:         certPEM(constrainedIssuer.cert),
+			trustAnchors: bundle(constrainedRoot.cert),
+			expErr:       true,
+		},
+		"issuer expiring before workload TTL should error": {
+			cert:         certPEM(shortIssuer.cert),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateDaprCompatibility(test.cert, test.trustAnchors, conf, now)
+			if (err != nil) != test.expErr {
+				t.Errorf("unexpected error, exp=%t got=%v", test.expErr, err)
+			}
+		})
+	}
+}
@@ -3,20 +3,28 @@ package controller
 import (
 	"bytes"
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
+	"time"
 
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
 	"github.com/diagridio/dapr-cert-manager/pkg/trustanchor"
 	"github.com/go-logr/logr"
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
 	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -30,30 +38,161 @@ type Options struct {
 	// Log is the logger used by the controllers.
 	Log logr.Logger
 
-	// DaprNamespace is the namespace that dapr is installed in.
-	// Required.
-	DaprNamespace string
+	// DaprNamespaces are the namespaces that dapr is installed in. Each
+	// namespace is its own isolated dapr control plane.
+	// Required if DaprNamespaceSelector is nil.
+	DaprNamespaces []string
+
+	// DaprNamespaceSelector optionally selects additional namespaces that
+	// dapr is installed in by their labels.
+	DaprNamespaceSelector labels.Selector
 
 	// TrustBundleCertificateName is the name of the cert-manager Certificate
 	// resource that is used to generate the trust-bundle. Must be in the same
-	// namespace as the dapr installation.
-	// Required.
+	// namespace as each dapr installation.
+	// Required if CertificateBindingsEnabled is false.
 	TrustBundleCertificateName string
 
 	// TrustAnchor is used for the trust-bundle trust anchors. If empty the nil,
 	// the `ca.crt` created by cert-manager will be used.
 	TrustAnchor trustanchor.Interface
+
+	// NamespaceTrustAnchors optionally overrides TrustAnchor for the dapr
+	// namespace of the map key.
+	NamespaceTrustAnchors map[string]trustanchor.Interface
+
+	// PruneExpiredTrustAnchors will remove trust anchors from the trust-bundle
+	// once they have expired for longer than TrustAnchorPruneGracePeriod. Trust
+	// anchors which the current issuer chains to are never removed.
+	PruneExpiredTrustAnchors bool
+
+	// TrustAnchorPruneGracePeriod is the duration after a trust anchor has
+	// expired before it is pruned from the trust-bundle.
+	TrustAnchorPruneGracePeriod time.Duration
+
+	// ReplaceTrustAnchors will set the trust-bundle to exactly the trust
+	// anchors of TrustAnchor, or NamespaceTrustAnchors, rather than appending
+	// to the current trust anchors. Trust anchors not in the source are
+	// removed. Has no effect for namespaces which use the `ca.crt` created by
+	// cert-manager.
+	ReplaceTrustAnchors bool
+
+	// RootRotationSoakPeriod enables orchestrating root CA rotations when
+	// non-zero. When the issuer is replaced by one which chains to a different
+	// root CA, the new root CA is first distributed alongside the old root CA,
+	// and the new issuer is held back until the new root CA has been in the
+	// trust-bundle for the soak period. The old root CA is then removed once
+	// the new issuer has been in use for the soak period.
+	RootRotationSoakPeriod time.Duration
+
+	// JWTSigningCertificateName is the name of the cert-manager Certificate
+	// resource whose private key is used as the JWT signing key of dapr Sentry.
+	// Must be in the same namespace as each dapr installation. The public key
+	// is appended to the JWKS in the dapr trust-bundle Secret. JWT signing keys
+	// are not managed if empty.
+	JWTSigningCertificateName string
+
+	// JWKSPruneGracePeriod is the duration after a key stopped being the JWT
+	// signing key before it is pruned from the JWKS. Keys are never pruned if
+	// zero.
+	JWKSPruneGracePeriod time.Duration
+
+	// JWTKeyID is the optional fixed key ID dapr Sentry signs JWTs with. If
+	// empty, the key ID of each signing key is its RFC 7638 JWK thumbprint.
+	// With a fixed key ID, the public key of the previous signing key is
+	// replaced in the JWKS, rather than kept alongside the new key.
+	JWTKeyID string
+
+	// HistoryLimit is the number of previous revisions of the issuer and
+	// trust-bundle of each dapr Secret to keep in history Secrets, so that
+	// they can be rolled back to. No history is kept if zero.
+	HistoryLimit int
+
+	// Provision optionally creates the TrustBundleCertificateName cert-manager
+	// Certificate if it does not exist.
+	Provision ProvisionOptions
+
+	// Bootstrap optionally creates the dapr Secrets with the issuer and trust
+	// anchors if they do not exist.
+	Bootstrap BootstrapOptions
+
+	// Truststores optionally configure PKCS#12 and JKS truststores which the
+	// trust bundle of the dapr trust-bundle Secret is additionally written as,
+	// for Java clients.
+	Truststores TruststoreOptions
+
+	// CertificateBindingsEnabled will reconcile a dapr Secret for every
+	// DaprCertificateBinding in the dapr namespaces, in addition to the
+	// TrustBundleCertificateName.
+	CertificateBindingsEnabled bool
+
+	// DryRun will log the changes which would be made to the dapr Secrets,
+	// rather than writing them.
+	DryRun bool
 }
 
 // secretCtrl is the controller that manages dapr certificate secrets.
 type secretCtrl struct {
-	log           logr.Logger
-	lister        client.Reader
-	client        client.Client
-	trustAnchor   x509bundle.Source
-	daprNamespace string
+	log       logr.Logger
+	lister    client.Reader
+	apiReader client.Reader
+	// secretReader reads the managed Secrets from the cache, which only caches
+	// Secrets by name. Secrets which have just been written are read back with
+	// apiReader.
+	secretReader client.Reader
+	// daprConfigReader reads the dapr system Configuration from the cache. Nil
+	// if the dapr Configuration resource was not served on start, in which case
+	// the dapr defaults are used.
+	daprConfigReader client.Reader
+	client           client.Client
+	trustAnchor      x509bundle.Source
+	clock            clock.PassiveClock
+	recorder         record.EventRecorder
 
-	confs []secretConf
+	daprNamespaces        map[string]struct{}
+	namespaceSelector     labels.Selector
+	namespaceTrustAnchors map[string]x509bundle.Source
+
+	pruneTrustAnchors   bool
+	pruneGracePeriod    time.Duration
+	replaceTrustAnchors bool
+
+	// rootRotationSoakPeriod gates each phase of a root CA rotation. Root CA
+	// rotations are not orchestrated if zero.
+	rootRotationSoakPeriod time.Duration
+
+	// jwtCertName is the name of the cert-manager Certificate of the JWT
+	// signing key. JWT signing keys are not managed if empty.
+	jwtCertName          string
+	jwksPruneGracePeriod time.Duration
+	jwtFixedKeyID        string
+
+	// historyLimit is the number of revisions of the dapr Secrets to keep in
+	// the history. No history is kept if zero.
+	historyLimit int
+
+	// provision configures the provisioning of the cert-manager Certificates
+	// of secretConfs with provision set.
+	provision ProvisionOptions
+
+	// bootstrap configures the creation of missing dapr Secrets. Missing dapr
+	// Secrets are not created if not enabled.
+	bootstrap BootstrapOptions
+
+	// truststores configure the truststores written to the dapr trust-bundle
+	// Secret. No truststores are written if not enabled.
+	truststores TruststoreOptions
+
+	// confs are the static secretConfs, reconciled in addition to those
+	// declared by DaprCertificateBindings if bindingsEnabled is true.
+	confs           []secretConf
+	bindingsEnabled bool
+
+	// dryRun reports pending updates rather than writing them. Plans are
+	// collected into plans if it is not nil.
+	dryRun   bool
+	planLock sync.Mutex
+	plans    []Plan
 }
 
 type secretConf struct {
@@ -63,11 +202,17 @@ type secretConf struct {
 	certSectretKey  string
 	certSecretPKKey string
 	certSecretCAKey string
+
+	// provision is true if the cert-manager Certificate is provisioned by
+	// dapr-cert-manager when it does not exist.
+	provision bool
 }
 
 // Reconcile will ensure that the dapr trust-bundle Secret is updated with the
 // latest issuer certificate. Will not delete the existing bundle if the
-// cert-manager Secret has no data, and will only append to the trust anchor.
+// cert-manager Secret has no data, and will only append to the trust anchor
+// unless pruning of expired trust anchors, or replacing trust anchors, is
+// enabled.
 func (s *secretCtrl) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// We should only ever be reconciling either the dapr trust-bundle Secret, or
 	// the cert-manager Certificate Secret.
@@ -77,77 +222,174 @@ func (s *secretCtrl) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 
 	log := s.log.WithValues("reconciled_secret", req.NamespacedName)
 
+	if !s.managesNamespace(ctx, req.Namespace) {
+		log.V(3).Info("namespace is not a managed dapr namespace")
+		return ctrl.Result{}, nil
+	}
+
+	confs, conflicts, err := s.listSecretConfs(ctx, req.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, conflict := range conflicts {
+		if conflict.self {
+			log.Error(nil, "skipping DaprCertificateBinding which writes the same target key more than once",
+				"binding", conflict.binding.Name, "secret", conflict.target.secretName, "key", conflict.target.key)
+			s.recordEvent(corev1.EventTypeWarning, reasonTargetConflict,
+				fmt.Sprintf("Ignoring binding: key %q of Secret %q is written more than once by the binding",
+					conflict.target.key, conflict.target.secretName), conflict.binding)
+			continue
+		}
+		log.Error(nil, "skipping DaprCertificateBinding whose target is already written for another Certificate",
+			"binding", conflict.binding.Name, "secret", conflict.target.secretName, "key", conflict.target.key, "certificate", conflict.owner.certName)
+		s.recordEvent(corev1.EventTypeWarning, reasonTargetConflict,
+			fmt.Sprintf("Ignoring binding: key %q of Secret %q is already written for Certificate %q",
+				conflict.target.key, conflict.target.secretName, conflict.owner.certName), conflict.binding)
+	}
+
+	// The dapr system Configuration is read once and shared by all confs.
+	daprConf, err := getDaprSystemConfig(ctx, s.daprConfigReader, req.Namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	var (
 		wg   sync.WaitGroup
 		lock sync.Mutex
 		errs []error
 	)
 
-	wg.Add(len(s.confs))
-	for _, conf := range s.confs {
+	var result ctrl.Result
+	wg.Add(len(confs))
+	for _, conf := range confs {
 		go func(conf secretConf) {
 			defer wg.Done()
-			if err := s.reconcileBundle(ctx, log, conf); err != nil {
-				lock.Lock()
+			requeueAfter, err := s.reconcileBundle(ctx, log, req.Namespace, conf, daprConf)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
 				errs = append(errs, err)
-				lock.Unlock()
+			}
+			if requeueAfter > 0 && (result.RequeueAfter == 0 || requeueAfter < result.RequeueAfter) {
+				result.RequeueAfter = requeueAfter
 			}
 		}(conf)
 	}
 
+	if len(s.jwtCertName) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			requeueAfter, err := s.reconcileJWT(ctx, log, req.Namespace)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if requeueAfter > 0 && (result.RequeueAfter == 0 || requeueAfter < result.RequeueAfter) {
+				result.RequeueAfter = requeueAfter
+			}
+		}()
+	}
+
 	wg.Wait()
+
+	// Truststores are rendered once the trust bundle has been written, so that
+	// they contain the same trust anchors.
+	if len(errs) == 0 && s.truststores.enabled() {
+		if err := s.reconcileTruststores(ctx, log, req.Namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return ctrl.Result{}, fmt.Errorf("failed to reconcile: %v", errors.Join(errs...))
 	}
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
-func (s *secretCtrl) reconcileBundle(ctx context.Context, log logr.Logger, conf secretConf) error {
-	log = log.WithValues("cert_name", conf.certName)
+// reconcileBundle reconciles the dapr Secrets of the given secretConf. Returns
+// a non-zero duration if the Secrets must be reconciled again after it, for
+// example when a phase of a root CA rotation is waiting on its soak period.
+func (s *secretCtrl) reconcileBundle(ctx context.Context, log logr.Logger, namespace string, conf secretConf, daprConf daprSystemConfig) (time.Duration, error) {
+	log = log.WithValues("cert_name", conf.certName, "dapr_namespace", namespace)
 	dbg := log.V(3)
 
 	dbg.Info("reconciling")
 
 	var cert cmapi.Certificate
-	err := s.lister.Get(ctx, types.NamespacedName{Namespace: s.daprNamespace, Name: conf.certName}, &cert)
+	err := s.lister.Get(ctx, types.NamespacedName{Namespace: namespace, Name: conf.certName}, &cert)
+	if conf.provision && (err == nil || apierrors.IsNotFound(err)) {
+		current := &cert
+		if err != nil {
+			current = nil
+		}
+		if err := s.provisionCertificate(ctx, log, namespace, conf, daprConf, current); err != nil {
+			return 0, err
+		}
+	}
 	if apierrors.IsNotFound(err) {
 		// The cert-manager Certificate resource does not exist, so we can't
-		// do anything.
+		// do anything. A provisioned Certificate is reconciled once it is
+		// ready.
 		dbg.Info("cert-manager Certificate resource does not exist")
-		return nil
+		return 0, nil
 	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	dbg.Info("found cert-manager Certificate resource")
 
 	var cmSecret corev1.Secret
-	err = s.lister.Get(ctx, types.NamespacedName{
+	err = s.secretReader.Get(ctx, types.NamespacedName{
 		Namespace: cert.Namespace,
 		Name:      cert.Spec.SecretName,
 	}, &cmSecret)
 	if apierrors.IsNotFound(err) {
 		dbg.Info("cert-manager Secret does not exist", "secret", cert.Spec.SecretName)
-		return nil
+		return 0, nil
 	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	dbg.Info("found cert-manager Secret", "secret", cert.Spec.SecretName)
 
+	if !hasIssuerData(cmSecret) {
+		dbg.Info("cert-manager Secret has no data")
+		s.recordEvent(corev1.EventTypeWarning, reasonSourceSecretEmpty,
+			fmt.Sprintf("cert-manager Secret %q has no issuer certificate or private key", cmSecret.Name), &cert)
+		return 0, nil
+	}
+
+	// bootstrap is true if the dapr certificate Secret does not exist and will
+	// be created, and bootstrapCA if the same is true of a separate dapr CA
+	// Secret.
+	var bootstrap, bootstrapCA bool
+
 	var daprCertSecret corev1.Secret
-	err = s.lister.Get(ctx, types.NamespacedName{
-		Namespace: s.daprNamespace,
+	err = s.secretReader.Get(ctx, types.NamespacedName{
+		Namespace: namespace,
 		Name:      conf.certSecretName,
 	}, &daprCertSecret)
+	if apierrors.IsNotFound(err) && s.bootstrap.Enabled {
+		log.Info("dapr certificate Secret does not exist, bootstrapping")
+		daprCertSecret, bootstrap, err = s.newBootstrapSecret(namespace, conf.certSecretName), true, nil
+	}
 	if apierrors.IsNotFound(err) {
 		log.Error(err, "dapr certificate Secret does not exist")
-		return nil
+		s.recordEvent(corev1.EventTypeWarning, reasonTargetSecretMissing,
+			fmt.Sprintf("dapr certificate Secret %q does not exist", conf.certSecretName), &cert)
+		return 0, nil
 	}
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	if paused(daprCertSecret) {
+		log.Info("reconciliation of dapr certificate Secret is paused", "annotation", AnnotationPaused)
+		return 0, nil
 	}
 
 	var daprCASecret corev1.Secret
@@ -155,103 +397,232 @@ func (s *secretCtrl) reconcileBundle(ctx context.Context, log logr.Logger, conf
 		if conf.caSecretName == conf.certSecretName {
 			daprCASecret = daprCertSecret
 		} else {
-			err = s.lister.Get(ctx, types.NamespacedName{
-				Namespace: s.daprNamespace,
+			err = s.secretReader.Get(ctx, types.NamespacedName{
+				Namespace: namespace,
 				Name:      conf.caSecretName,
 			}, &daprCASecret)
+			if apierrors.IsNotFound(err) && bootstrap {
+				daprCASecret, bootstrapCA, err = s.newBootstrapSecret(namespace, conf.caSecretName), true, nil
+			}
 			if apierrors.IsNotFound(err) {
 				log.Error(err, "dapr CA certificate Secret does not exist")
-				return nil
+				s.recordEvent(corev1.EventTypeWarning, reasonTargetSecretMissing,
+					fmt.Sprintf("dapr CA certificate Secret %q does not exist", conf.caSecretName), &cert)
+				return 0, nil
 			}
 			if err != nil {
-				return err
+				return 0, err
 			}
 		}
 	}
 
 	dbg.Info("found dapr certificate Secret")
 
-	ta, shouldReconcile, err := s.shouldReconcileSecret(log, dbg, conf, daprCertSecret, daprCASecret, cmSecret)
+	update, shouldReconcile, err := s.shouldReconcileSecret(log, dbg, conf, daprConf, s.trustAnchorFor(namespace), daprCertSecret, daprCASecret, cmSecret)
+	if verr := new(validationError); errors.As(err, &verr) {
+		validationRejectionsTotal.WithLabelValues(namespace, conf.certSecretName).Inc()
+		s.recordEvent(corev1.EventTypeWarning, reasonValidationFailed,
+			fmt.Sprintf("Refusing to update dapr Secret with issuer from cert-manager Secret %q: %s", cmSecret.Name, verr.err), &daprCertSecret, &cert)
+	}
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if !shouldReconcile {
 		log.Info("dapr trust-bundle Secret is up to date")
-		return nil
+		observeSync(s.clock, namespace, conf, daprCertSecret.Data[conf.certSectretKey], daprCASecret.Data[conf.certSecretCAKey])
+		if update != nil {
+			return update.requeueAfter, nil
+		}
+		return 0, nil
 	}
 
-	log.Info("updating dapr certificate Secret")
+	if s.dryRun {
+		s.reportPlan(log, newPlan(namespace, conf, update))
+		return update.requeueAfter, nil
+	}
 
-	// Preserve existing keys in the dapr certificate Secret since it might be
-	// the case that the same Secret is used for the cert-manager Certificate for
-	// example.
-	if daprCertSecret.Data == nil {
-		daprCertSecret.Data = make(map[string][]byte)
+	if bootstrap {
+		return update.requeueAfter, s.createBootstrapSecrets(ctx, log, namespace, conf, update, cmSecret, &daprCertSecret, &daprCASecret, bootstrapCA, &cert)
 	}
-	daprCertSecret.Data[conf.certSectretKey] = cmSecret.Data[corev1.TLSCertKey]
-	daprCertSecret.Data[conf.certSecretPKKey] = cmSecret.Data[corev1.TLSPrivateKeyKey]
 
-	if err := s.client.Update(ctx, &daprCertSecret); err != nil {
-		return err
+	log.Info("updating dapr certificate Secret")
+
+	// The current issuer and trust anchors are saved to the history before
+	// either is overwritten, so that they can be rolled back to.
+	if s.historyLimit > 0 && (len(update.added) > 0 || len(update.pruned) > 0 || len(update.removed) > 0 ||
+		(!update.holdIssuer && issuerPending(conf, daprCertSecret, cmSecret))) {
+		err := s.saveHistory(ctx, log, namespace, conf, daprCertSecret, daprCASecret)
+		if err := s.observeWriteStep(log, namespace, conf.certSecretName, writeStepHistory, err, &daprCertSecret, &cert); err != nil {
+			return 0, err
+		}
 	}
 
-	if len(conf.caSecretName) == 0 {
-		return nil
+	// The trust anchors are written, and read back, before the issuer so that
+	// dapr never runs with an issuer whose root CA is not yet trusted. A failed
+	// step skips all later steps, and the next reconcile resumes from the
+	// first step which has not been completed.
+	var (
+		taPEM     []byte
+		taPatched bool
+	)
+	if len(conf.caSecretName) > 0 {
+		taPEM = daprCASecret.Data[conf.certSecretCAKey]
+		if len(update.added) > 0 || len(update.pruned) > 0 || len(update.removed) > 0 {
+			taPEM, err = s.patchTrustAnchors(ctx, conf, &daprCASecret, update)
+			if err := s.observeWriteStep(log, namespace, conf.caSecretName, writeStepTrustAnchors, err, &daprCASecret, &cert); err != nil {
+				return 0, err
+			}
+			taPatched = true
+			updatesTotal.WithLabelValues(namespace, conf.caSecretName).Inc()
+
+			for _, anchor := range update.pruned {
+				log.Info("pruned expired trust anchor from dapr trust-bundle Secret", certificateLogValues(anchor)...)
+			}
+			if len(update.pruned) > 0 {
+				trustAnchorsPrunedTotal.WithLabelValues(daprCASecret.Namespace, daprCASecret.Name).Add(float64(len(update.pruned)))
+			}
+			for _, anchor := range update.removed {
+				log.Info("removed trust anchor from dapr trust-bundle Secret", certificateLogValues(anchor)...)
+			}
+			s.recordTrustAnchorChanges(update, &daprCASecret, &cert)
+		}
+
+		if conf.caSecretName == conf.certSecretName {
+			daprCertSecret = daprCASecret
+		}
 	}
 
-	taPEM, err := ta.Marshal()
-	if err != nil {
-		// This error should never really happen since we just parsed the certs.
-		// We are extra noisy here so its easier to pick up by the user and report
-		// the bug.
-		log.Error(err, "failed to marshal trust anchor, this error is a bug, please report the issue to Diagrid")
-		return fmt.Errorf("this error is a bug, please report this issue to Diagrid: %w", err)
+	if !update.holdIssuer && issuerPending(conf, daprCertSecret, cmSecret) {
+		if len(conf.caSecretName) > 0 {
+			err := s.verifyTrustAnchors(ctx, conf, client.ObjectKeyFromObject(&daprCASecret), update, cmSecret.Data[corev1.TLSCertKey])
+			if err := s.observeWriteStep(log, namespace, conf.caSecretName, writeStepVerify, err, &daprCASecret, &cert); err != nil {
+				return 0, err
+			}
+		}
+
+		// Only patch the issuer keys, preserving all other keys in the dapr
+		// certificate Secret since it might be the case that the same Secret is
+		// used for the cert-manager Certificate, or written by Helm or Sentry
+		// for example.
+		_, err := s.patchSecretData(ctx, &daprCertSecret, map[string][]byte{
+			conf.certSectretKey:  cmSecret.Data[corev1.TLSCertKey],
+			conf.certSecretPKKey: cmSecret.Data[corev1.TLSPrivateKeyKey],
+		})
+		if err := s.observeWriteStep(log, namespace, conf.certSecretName, writeStepIssuer, err, &daprCertSecret, &cert); err != nil {
+			return 0, err
+		}
+
+		if !taPatched || conf.caSecretName != conf.certSecretName {
+			updatesTotal.WithLabelValues(namespace, conf.certSecretName).Inc()
+		}
+		s.recordIssuerRotated(update, &daprCertSecret, &cert)
 	}
 
-	if conf.caSecretName == conf.certSecretName {
-		daprCASecret = daprCertSecret
+	if len(conf.caSecretName) == 0 {
+		observeSync(s.clock, namespace, conf, daprCertSecret.Data[conf.certSectretKey], nil)
+		return 0, nil
 	}
 
-	if daprCASecret.Data == nil {
-		daprCASecret.Data = make(map[string][]byte)
+	// The rotation status is persisted last, so that a phase is only ever
+	// recorded once the dapr Secrets have been updated for it.
+	if update.rotation != nil {
+		err := s.patchRotationStatus(ctx, &daprCASecret, update.rotation)
+		if err := s.observeWriteStep(log, namespace, conf.caSecretName, writeStepRotationStatus, err, &daprCASecret, &cert); err != nil {
+			return 0, err
+		}
+		s.recordRootRotation(update.rotation, &daprCASecret, &cert)
 	}
-	daprCASecret.Data[conf.certSecretCAKey] = taPEM
 
-	return s.client.Update(ctx, &daprCASecret)
+	observeSync(s.clock, namespace, conf, daprCertSecret.Data[conf.certSectretKey], taPEM)
+
+	return update.requeueAfter, nil
+}
+
+// bundleUpdate is the desired state of the trust anchors in the dapr
+// trust-bundle Secret.
+type bundleUpdate struct {
+	// trustAnchors is the trust bundle to write to the dapr CA Secret.
+	trustAnchors *x509bundle.Bundle
+
+	// added are the trust anchors which have been added to the current dapr
+	// trust bundle.
+	added []*x509.Certificate
+
+	// pruned are the expired trust anchors which have been removed from the
+	// current dapr trust bundle.
+	pruned []*x509.Certificate
+
+	// removed are the trust anchors which have been removed from the current
+	// dapr trust bundle because they are not in the trust anchor source.
+	removed []*x509.Certificate
+
+	// authoritative is true if trustAnchors is exactly the trust anchors of
+	// the trust anchor source, and the roots of the issuers in use, rather
+	// than appended to the current trust bundle.
+	authoritative bool
+
+	// holdIssuer is true if the issuer must not yet be written, because its
+	// root CA has not been distributed for the root rotation soak period.
+	holdIssuer bool
+
+	// rotation is the new status of the root CA rotation to persist. Nil if
+	// the status is unchanged.
+	rotation *rotationStatus
+
+	// requeueAfter is the duration after which the dapr Secrets must be
+	// reconciled again. Zero if no requeue is needed.
+	requeueAfter time.Duration
+
+	// issuer is the new issuer certificate, if it is being rotated. Nil if the
+	// issuer is unchanged.
+	issuer *x509.Certificate
+
+	// previousIssuer is the issuer certificate being replaced. Nil if the
+	// issuer is unchanged, or there was no valid previous issuer.
+	previousIssuer *x509.Certificate
 }
 
 // shouldReconcileSecret returns true if the Secret should be reconciled.
 // Also returns the trust anchors for which to update the dapr trust-bundle
-// Secret with.
+// Secret with. The returned update may be non-nil when the Secret should not
+// be reconciled, in which case only its requeueAfter is set.
 func (s *secretCtrl) shouldReconcileSecret(log, dbg logr.Logger,
-	conf secretConf,
+	conf secretConf, daprConf daprSystemConfig, trustAnchor x509bundle.Source,
 	daprCertSecret, daprCASecret, cmSecret corev1.Secret,
-) (*x509bundle.Bundle, bool, error) {
+) (*bundleUpdate, bool, error) {
 	var shouldReconcile bool
 
 	// If the cert-manager Secret has no data, we can't do anything.
-	if len(cmSecret.Data) == 0 ||
-		len(cmSecret.Data[corev1.TLSCertKey]) == 0 ||
-		len(cmSecret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+	if !hasIssuerData(cmSecret) {
 		dbg.Info("cert-manager Secret has no data")
 		return nil, false, nil
 	}
 
-	if daprCertSecret.Data == nil ||
-		!bytes.Equal(daprCertSecret.Data[conf.certSectretKey], cmSecret.Data[corev1.TLSCertKey]) ||
-		!bytes.Equal(daprCertSecret.Data[conf.certSecretPKKey], cmSecret.Data[corev1.TLSPrivateKeyKey]) {
+	update := new(bundleUpdate)
+	var issuerChanged bool
+	// sourceTA is the trust bundle of an authoritative trust anchor source,
+	// which the issuer must chain to.
+	var sourceTA *x509bundle.Bundle
+	if daprCertSecret.Data == nil || issuerPending(conf, daprCertSecret, cmSecret) {
 		dbg.Info("data in dapr certificate Secret does not match cert-manager Secret")
-		shouldReconcile = true
-	}
+		issuerChanged = true
 
-	var daprTA *x509bundle.Bundle
+		if !bytes.Equal(daprCertSecret.Data[conf.certSectretKey], cmSecret.Data[corev1.TLSCertKey]) {
+			if chain, err := parseCertificates(cmSecret.Data[corev1.TLSCertKey]); err == nil {
+				update.issuer = chain[0]
+			}
+			if chain, err := parseCertificates(daprCertSecret.Data[conf.certSectretKey]); err == nil {
+				update.previousIssuer = chain[0]
+			}
+		}
+	}
 	if len(conf.caSecretName) > 0 {
 		// Ensure the dapr trust-bundle Secret has the trust anchor of the helper.
 		var cmTA *x509bundle.Bundle
-		if s.trustAnchor != nil {
+		if trustAnchor != nil {
 			var err error
-			cmTA, err = s.trustAnchor.GetX509BundleForTrustDomain(spiffeid.TrustDomain{})
+			cmTA, err = trustAnchor.GetX509BundleForTrustDomain(spiffeid.TrustDomain{})
 			if err != nil {
 				return nil, false, err
 			}
@@ -270,35 +641,154 @@ func (s *secretCtrl) shouldReconcileSecret(log, dbg logr.Logger,
 			}
 		}
 
+		currentTA := x509bundle.New(spiffeid.TrustDomain{})
 		if len(daprCASecret.Data[conf.certSecretCAKey]) > 0 {
 			var err error
-			daprTA, err = x509bundle.Parse(spiffeid.TrustDomain{}, daprCASecret.Data[conf.certSecretCAKey])
+			currentTA, err = x509bundle.Parse(spiffeid.TrustDomain{}, daprCASecret.Data[conf.certSecretCAKey])
 			if err != nil {
 				return nil, false, fmt.Errorf("failed to parse trust anchor from dapr certificate Secret: %w", err)
 			}
-		} else {
-			daprTA = x509bundle.New(spiffeid.TrustDomain{})
 		}
 
+		daprTA := currentTA.Clone()
+		if s.replaceTrustAnchors && trustAnchor != nil {
+			// The trust anchor source is authoritative, so the trust bundle is
+			// replaced. The issuer is still validated to chain to the source
+			// below. As when pruning, the roots of the current and pending
+			// issuers are kept until the current issuer has been switched, so
+			// that the issuer in use by dapr is never orphaned.
+			issuers, err := issuerChains(dbg, conf, daprCertSecret, cmSecret)
+			if err != nil {
+				return nil, false, err
+			}
+			daprTA = cmTA.Clone()
+			for _, cert := range currentTA.X509Authorities() {
+				if !daprTA.HasX509Authority(cert) && slices.ContainsFunc(issuers, func(issuer []*x509.Certificate) bool {
+					return chainsTo(issuer, cert)
+				}) {
+					dbg.Info("keeping trust anchor of issuer in use which is not in the trust anchor source", "fingerprint", fingerprint(cert))
+					daprTA.AddX509Authority(cert)
+				}
+			}
+			sourceTA = cmTA
+			update.authoritative = true
+		}
 		for _, cert := range cmTA.X509Authorities() {
 			if !daprTA.HasX509Authority(cert) {
-				shouldReconcile = true
 				daprTA.AddX509Authority(cert)
 				dbg.Info("dapr trust-bundle Secret is missing trust anchor")
 			}
 		}
+
+		if s.pruneTrustAnchors {
+			issuers, err := issuerChains(dbg, conf, daprCertSecret, cmSecret)
+			if err != nil {
+				return nil, false, err
+			}
+
+			for _, cert := range pruneExpiredTrustAnchors(daprTA, issuers, s.clock.Now(), s.pruneGracePeriod) {
+				// Expired trust anchors which are not yet in the dapr trust bundle
+				// are simply never added.
+				if currentTA.HasX509Authority(cert) {
+					update.pruned = append(update.pruned, cert)
+				}
+			}
+		}
+
+		if s.rootRotationSoakPeriod > 0 {
+			s.rotateRoot(log, conf, daprCertSecret, daprCASecret, cmSecret, currentTA, daprTA, update)
+			if update.holdIssuer {
+				update.issuer, update.previousIssuer = nil, nil
+			}
+			if update.rotation != nil {
+				shouldReconcile = true
+			}
+		}
+
+		for _, cert := range daprTA.X509Authorities() {
+			if !currentTA.HasX509Authority(cert) {
+				update.added = append(update.added, cert)
+			}
+		}
+		for _, cert := range currentTA.X509Authorities() {
+			if !daprTA.HasX509Authority(cert) && !slices.ContainsFunc(update.pruned, cert.Equal) {
+				update.removed = append(update.removed, cert)
+			}
+		}
+
+		// The trust bundle will be unchanged if the only trust anchors which have
+		// been added were also pruned.
+		if !daprTA.Equal(currentTA) {
+			shouldReconcile = true
+		}
+
+		update.trustAnchors = daprTA
+	}
+
+	if issuerChanged && !update.holdIssuer {
+		shouldReconcile = true
 	}
 
-	if shouldReconcile {
-		return daprTA, true, nil
+	if !shouldReconcile {
+		dbg.Info("dapr trust-bundle Secret has correct issuer and all required trust anchor")
+		return update, false, nil
+	}
+
+	// Never write an issuer to dapr which is not appropriate, since this will
+	// break mTLS for every dapr sidecar.
+	now := s.clock.Now()
+	issuerTA := update.trustAnchors
+	if sourceTA != nil {
+		issuerTA = sourceTA
+	}
+	if err := validateIssuer(cmSecret.Data[corev1.TLSCertKey], cmSecret.Data[corev1.TLSPrivateKeyKey], issuerTA, now); err != nil {
+		log.Error(err, "refusing to update dapr trust-bundle Secret")
+		return nil, false, err
+	}
+	if err := validateDaprCompatibility(cmSecret.Data[corev1.TLSCertKey], update.trustAnchors, daprConf, now); err != nil {
+		log.Error(err, "refusing to update dapr trust-bundle Secret, issuer is not compatible with dapr Sentry")
+		return nil, false, err
 	}
 
-	dbg.Info("dapr trust-bundle Secret has correct issuer and all required trust anchor")
+	return update, true, nil
+}
 
-	// TODO: @joshvanl do validation to ensure that the certificates are
-	// appropriate.
+// issuerPending returns true if the issuer of the dapr certificate Secret
+// does not match that of the cert-manager Secret.
+func issuerPending(conf secretConf, daprCertSecret, cmSecret corev1.Secret) bool {
+	return !bytes.Equal(daprCertSecret.Data[conf.certSectretKey], cmSecret.Data[corev1.TLSCertKey]) ||
+		!bytes.Equal(daprCertSecret.Data[conf.certSecretPKKey], cmSecret.Data[corev1.TLSPrivateKeyKey])
+}
 
-	return nil, false, nil
+// hasIssuerData returns true if the cert-manager Secret contains both an
+// issuer certificate and private key.
+func hasIssuerData(cmSecret corev1.Secret) bool {
+	return len(cmSecret.Data[corev1.TLSCertKey]) > 0 && len(cmSecret.Data[corev1.TLSPrivateKeyKey]) > 0
+}
+
+// issuerChains returns the issuer certificate chains which are in use, or are
+// about to be in use, by dapr. Trust anchors which these chains chain to must
+// never be removed from the dapr trust bundle.
+func issuerChains(dbg logr.Logger, conf secretConf, daprCertSecret, cmSecret corev1.Secret) ([][]*x509.Certificate, error) {
+	cmIssuer, err := parseCertificates(cmSecret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issuer certificate from cert-manager Secret: %w", err)
+	}
+
+	issuers := [][]*x509.Certificate{cmIssuer}
+
+	if len(daprCertSecret.Data[conf.certSectretKey]) > 0 {
+		daprIssuer, err := parseCertificates(daprCertSecret.Data[conf.certSectretKey])
+		if err != nil {
+			// The existing issuer is going to be replaced by that of cert-manager so
+			// we don't need to protect its trust anchor.
+			dbg.Info("failed to parse existing issuer certificate from dapr certificate Secret", "error", err)
+		} else {
+			issuers = append(issuers, daprIssuer)
+		}
+	}
+
+	return issuers, nil
 }
 
 // AddTrustBundle will register the trust-bundle controller with the
@@ -306,40 +796,37 @@ func (s *secretCtrl) shouldReconcileSecret(log, dbg logr.Logger,
 // The trust-bundle controller will reconcile the target trust-bundle
 // cert-manager Certificate resource, and ensure that the dapr trust-bundle is
 // updated with the latest issuer certificate.
-// Trust anchors are always appended to the trust-bundle, and never removed.
+// Trust anchors are always appended to the trust-bundle, and are only removed
+// once expired if pruning is enabled.
 func AddTrustBundle(mgr ctrl.Manager, opts Options) error {
-	log := opts.Log.WithName("controller").WithName("trust-bundle")
+	secCtl, err := newSecretCtrl(opts)
+	if err != nil {
+		return err
+	}
+
+	log := secCtl.log
 	lister := mgr.GetCache()
+	secCtl.lister = lister
+	secCtl.apiReader = mgr.GetAPIReader()
+	secCtl.secretReader = lister
+	secCtl.client = mgr.GetClient()
+	secCtl.recorder = mgr.GetEventRecorderFor("dapr-cert-manager")
 
-	secCtl := &secretCtrl{
-		log:           log,
-		lister:        lister,
-		client:        mgr.GetClient(),
-		trustAnchor:   opts.TrustAnchor,
-		daprNamespace: opts.DaprNamespace,
-	}
-	if len(opts.TrustBundleCertificateName) > 0 {
-		secCtl.confs = append(secCtl.confs, secretConf{
-			certName:        opts.TrustBundleCertificateName,
-			certSecretName:  "dapr-trust-bundle",
-			caSecretName:    "dapr-trust-bundle",
-			certSectretKey:  "issuer.crt",
-			certSecretPKKey: "issuer.key",
-			certSecretCAKey: "ca.crt",
-		})
+	daprConfigServed, err := daprConfigurationServed(mgr.GetRESTMapper())
+	if err != nil {
+		return err
 	}
-
-	if len(secCtl.confs) == 0 {
-		return errors.New("no certificate names provided")
+	if daprConfigServed {
+		secCtl.daprConfigReader = lister
+	} else {
+		log.Info("dapr Configuration resource is not served, using the dapr default workload certificate TTL and trust domain")
 	}
 
-	// TODO: @joshvanl add custom source to re-reconcile when the trust anchor
-	// changes on file.
-
 	controller := ctrl.NewControllerManagedBy(mgr).
-		// Watch the target trust-bundle Secret.
-		For(new(corev1.Secret), builder.OnlyMetadata, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
-			return obj.GetNamespace() == opts.DaprNamespace && obj.GetName() == "dapr-trust-bundle"
+		// Watch the target dapr Secrets.
+		For(new(corev1.Secret), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			ctx := context.Background()
+			return secCtl.managesNamespace(ctx, obj.GetNamespace()) && secCtl.managesSecret(ctx, obj.GetNamespace(), obj.GetName())
 		}))).
 
 		// Watch the trust-bundle Certificate resource. Reconcile the Secret on
@@ -349,6 +836,10 @@ func AddTrustBundle(mgr ctrl.Manager, opts Options) error {
 				var cert cmapi.Certificate
 				err := lister.Get(ctx, client.ObjectKeyFromObject(obj), &cert)
 				if apierrors.IsNotFound(err) {
+					if opts.Provision.Enabled {
+						// Provision the Certificate again once it has been deleted.
+						return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: "dapr-trust-bundle"}}}
+					}
 					// Do nothing if the Certificate does not exist.
 					return nil
 				}
@@ -375,17 +866,161 @@ func AddTrustBundle(mgr ctrl.Manager, opts Options) error {
 			},
 		), builder.OnlyMetadata, builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
 			// Only reconcile the cert-manager Certificates we are watching.
-			return obj.GetNamespace() == opts.DaprNamespace && obj.GetName() == opts.TrustBundleCertificateName
+			ctx := context.Background()
+			return secCtl.managesNamespace(ctx, obj.GetNamespace()) && secCtl.watchesCertificate(ctx, obj.GetNamespace(), obj.GetName())
 		})))
 
+	if opts.CertificateBindingsEnabled {
+		// Reconcile the target Secret when a DaprCertificateBinding changes.
+		controller = controller.Watches(new(v1alpha1.DaprCertificateBinding), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				binding, ok := obj.(*v1alpha1.DaprCertificateBinding)
+				if !ok {
+					return nil
+				}
+				return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: binding.Spec.Target.SecretName}}}
+			},
+		), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return secCtl.managesNamespace(context.Background(), obj.GetNamespace())
+		})))
+	}
+
+	if daprConfigServed {
+		// Validate the dapr Secrets again when the dapr system Configuration
+		// changes, since the workload certificate TTL or trust domain may no
+		// longer be permitted by the issuer.
+		controller = controller.Watches(newDaprSystemConfiguration(), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: "dapr-trust-bundle"}}}
+			},
+		), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == daprSystemConfigurationName && secCtl.managesNamespace(context.Background(), obj.GetNamespace())
+		})))
+	}
+
+	if opts.Truststores.enabled() {
+		// Render the truststores again when their password changes.
+		controller = controller.Watches(new(corev1.Secret), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: truststoreSecretName}}}
+			},
+		), builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == opts.Truststores.PasswordSecretName && secCtl.managesNamespace(context.Background(), obj.GetNamespace())
+		})))
+	}
+
+	if opts.Provision.Enabled {
+		// Reconcile all dapr namespaces on start, since neither the
+		// Certificate to provision nor the dapr Secrets may exist to trigger a
+		// reconcile.
+		controller = controller.WatchesRawSource(source.Func(
+			func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[ctrl.Request]) error {
+				namespaces, err := secCtl.managedNamespaces(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to list managed dapr namespaces: %w", err)
+				}
+				for _, namespace := range namespaces {
+					queue.Add(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "dapr-trust-bundle"}})
+				}
+				return nil
+			}))
+	}
+
+	if opts.DaprNamespaceSelector != nil {
+		// Reconcile all dapr Secrets in a namespace when its labels change, since
+		// it may have started matching the selector.
+		controller = controller.Watches(new(corev1.Namespace), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetName(), Name: "dapr-trust-bundle"}}}
+			},
+		), builder.WithPredicates(predicate.LabelChangedPredicate{}))
+	}
+
 	if opts.TrustAnchor != nil {
 		controller = controller.WatchesRawSource(source.Channel(
 			opts.TrustAnchor.EventChannel(),
 			handler.EnqueueRequestsFromMapFunc(
-				func(_ context.Context, obj client.Object) []ctrl.Request {
-					return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: opts.DaprNamespace, Name: "dapr-trust-bundle"}}}
+				func(ctx context.Context, _ client.Object) []ctrl.Request {
+					return secCtl.trustAnchorRequests(ctx)
+				})))
+	}
+
+	for namespace, ta := range opts.NamespaceTrustAnchors {
+		controller = controller.WatchesRawSource(source.Channel(
+			ta.EventChannel(),
+			handler.EnqueueRequestsFromMapFunc(
+				func(context.Context, client.Object) []ctrl.Request {
+					return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "dapr-trust-bundle"}}}
 				})))
 	}
 
 	return controller.Complete(secCtl)
 }
+
+// newSecretCtrl returns a secretCtrl configured with the given Options. The
+// readers, client and event recorder must be set by the caller.
+func newSecretCtrl(opts Options) (*secretCtrl, error) {
+	secCtl := &secretCtrl{
+		log:         opts.Log.WithName("controller").WithName("trust-bundle"),
+		trustAnchor: opts.TrustAnchor,
+		clock:       clock.RealClock{},
+
+		daprNamespaces:        make(map[string]struct{}),
+		namespaceSelector:     opts.DaprNamespaceSelector,
+		namespaceTrustAnchors: make(map[string]x509bundle.Source),
+
+		pruneTrustAnchors:      opts.PruneExpiredTrustAnchors,
+		pruneGracePeriod:       opts.TrustAnchorPruneGracePeriod,
+		replaceTrustAnchors:    opts.ReplaceTrustAnchors,
+		rootRotationSoakPeriod: opts.RootRotationSoakPeriod,
+		jwtCertName:            opts.JWTSigningCertificateName,
+		jwksPruneGracePeriod:   opts.JWKSPruneGracePeriod,
+		jwtFixedKeyID:          opts.JWTKeyID,
+		historyLimit:           opts.HistoryLimit,
+		provision:              opts.Provision,
+		bootstrap:              opts.Bootstrap,
+		truststores:            opts.Truststores,
+		bindingsEnabled:        opts.CertificateBindingsEnabled,
+		dryRun:                 opts.DryRun,
+	}
+	if len(opts.TrustBundleCertificateName) > 0 {
+		secCtl.confs = append(secCtl.confs, secretConf{
+			certName:        opts.TrustBundleCertificateName,
+			certSecretName:  "dapr-trust-bundle",
+			caSecretName:    "dapr-trust-bundle",
+			certSectretKey:  v1alpha1.DefaultCertificateKey,
+			certSecretPKKey: v1alpha1.DefaultPrivateKeyKey,
+			certSecretCAKey: v1alpha1.DefaultCAKey,
+			provision:       opts.Provision.Enabled,
+		})
+	}
+	if opts.Provision.Enabled && len(opts.TrustBundleCertificateName) == 0 {
+		return nil, errors.New("trust-bundle certificate name must be provided to provision the cert-manager Certificate")
+	}
+
+	if len(secCtl.confs) == 0 && !opts.CertificateBindingsEnabled && len(opts.JWTSigningCertificateName) == 0 {
+		return nil, errors.New("no certificate names provided")
+	}
+
+	if opts.Truststores.enabled() {
+		if len(opts.Truststores.PasswordSecretName) == 0 || len(opts.Truststores.PasswordSecretKey) == 0 {
+			return nil, errors.New("truststore password Secret must be provided if truststores are enabled")
+		}
+		if _, err := pkcs12Encoder(opts.Truststores.PKCS12Profile); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, namespace := range opts.DaprNamespaces {
+		secCtl.daprNamespaces[namespace] = struct{}{}
+	}
+	if len(secCtl.daprNamespaces) == 0 && opts.DaprNamespaceSelector == nil {
+		return nil, errors.New("no dapr namespaces provided")
+	}
+
+	for namespace, ta := range opts.NamespaceTrustAnchors {
+		secCtl.namespaceTrustAnchors[namespace] = ta
+	}
+
+	return secCtl, nil
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2/klogr"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testSecretConf is the secretConf of the default dapr-trust-bundle Secret.
+var testSecretConf = secretConf{
+	certName:        "dapr-trust-bundle",
+	certSecretName:  "dapr-trust-bundle",
+	caSecretName:    "dapr-trust-bundle",
+	certSectretKey:  "issuer.crt",
+	certSecretPKKey: "issuer.key",
+	certSecretCAKey: "ca.crt",
+}
+
+// testObjects returns the cert-manager Certificate and Secret, and dapr
+// trust-bundle Secret used by the controller tests.
+func testObjects(t *testing.T, issuer, root *testCA, daprData map[string][]byte) []client.Object {
+	t.Helper()
+	return []client.Object{
+		&cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+			Spec:       cmapi.CertificateSpec{SecretName: "dapr-trust-bundle-from-cert-manager"},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle-from-cert-manager"},
+			Data: map[string][]byte{
+				"tls.crt": certPEM(issuer.cert),
+				"tls.key": keyPEM(t, issuer.key),
+				"ca.crt":  certPEM(root.cert),
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+			Data:       daprData,
+		},
+	}
+}
+
+// newTestSecretCtrl returns a secretCtrl backed by a fake client containing
+// the given objects.
+func newTestSecretCtrl(t *testing.T, now time.Time, objs ...client.Object) (*secretCtrl, *record.FakeRecorder) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmapi.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	recorder := record.NewFakeRecorder(10)
+
+	return &secretCtrl{
+		log:              klogr.New(),
+		lister:           cl,
+		apiReader:        cl,
+		secretReader:     cl,
+		daprConfigReader: cl,
+		client:           cl,
+		clock:            clocktesting.NewFakePassiveClock(now),
+		recorder:         recorder,
+		daprNamespaces:   map[string]struct{}{"dapr-system": {}},
+		confs:            []secretConf{testSecretConf},
+	}, recorder
+}
+
+// drainEvents returns all events recorded by the fake recorder.
+func drainEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func Test_reconcileBundle(t *testing.T) {
+	now := time.Now()
+	oldRoot := genCA(t, "old-root", nil, now.Add(-time.Hour*48), now.Add(time.Hour*48))
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	t.Run("empty dapr Secret should be populated with issuer and appended trust anchors", func(t *testing.T) {
+		s, recorder := newTestSecretCtrl(t, now, testObjects(t, issuer, root, map[string][]byte{
+			"ca.crt": certPEM(oldRoot.cert),
+		})...)
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(secret.Data["issuer.crt"], certPEM(issuer.cert)) {
+			t.Errorf("unexpected issuer.crt in dapr Secret")
+		}
+
+		bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data["ca.crt"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bundle.Equal(x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{oldRoot.cert, root.cert})) {
+			t.Errorf("expected trust bundle to contain old and new root, got %d trust anchors", len(bundle.X509Authorities()))
+		}
+
+		events := strings.Join(drainEvents(recorder), "\n")
+		for _, reason := range []string{reasonIssuerRotated, reasonTrustAnchorsAdded} {
+			if !strings.Contains(events, reason) {
+				t.Errorf("expected %s event, got %q", reason, events)
+			}
+		}
+	})
+
+	t.Run("invalid issuer should not update dapr Secret and record event", func(t *testing.T) {
+		expiredIssuer := genCA(t, "expired-issuer", root, now.Add(-time.Hour*2), now.Add(-time.Hour))
+		s, recorder := newTestSecretCtrl(t, now, testObjects(t, expiredIssuer, root, nil)...)
+
+		_, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig())
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if len(secret.Data) > 0 {
+			t.Errorf("expected dapr Secret to not be updated")
+		}
+
+		if events := strings.Join(drainEvents(recorder), "\n"); !strings.Contains(events, reasonValidationFailed) {
+			t.Errorf("expected %s event, got %q", reasonValidationFailed, events)
+		}
+	})
+
+	t.Run("replace trust anchors should remove trust anchors not in the source", func(t *testing.T) {
+		s, recorder := newTestSecretCtrl(t, now, testObjects(t, issuer, root, map[string][]byte{
+			"ca.crt": certPEM(oldRoot.cert, root.cert),
+		})...)
+		s.trustAnchor = x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{root.cert})
+		s.replaceTrustAnchors = true
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(secret.Data["ca.crt"], certPEM(root.cert)) {
+			t.Errorf("expected trust bundle to only contain the new root, got %q", secret.Data["ca.crt"])
+		}
+
+		if events := strings.Join(drainEvents(recorder), "\n"); !strings.Contains(events, reasonTrustAnchorsRemoved) {
+			t.Errorf("expected %s event, got %q", reasonTrustAnchorsRemoved, events)
+		}
+	})
+
+	t.Run("replace trust anchors should not remove the trust anchor of the issuer", func(t *testing.T) {
+		s, _ := newTestSecretCtrl(t, now, testObjects(t, issuer, root, map[string][]byte{
+			"ca.crt": certPEM(oldRoot.cert, root.cert),
+		})...)
+		s.trustAnchor = x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{oldRoot.cert})
+		s.replaceTrustAnchors = true
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err == nil {
+			t.Fatal("expected error")
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(secret.Data["ca.crt"], certPEM(oldRoot.cert, root.cert)) {
+			t.Errorf("expected trust bundle to be unchanged, got %q", secret.Data["ca.crt"])
+		}
+	})
+
+	t.Run("replace trust anchors should keep the root of the current issuer until it is switched", func(t *testing.T) {
+		oldIssuer := genCA(t, "old-issuer", oldRoot, now.Add(-time.Hour), now.Add(time.Hour*47))
+		s, _ := newTestSecretCtrl(t, now, testObjects(t, issuer, root, map[string][]byte{
+			"issuer.crt": certPEM(oldIssuer.cert),
+			"issuer.key": keyPEM(t, oldIssuer.key),
+			"ca.crt":     certPEM(oldRoot.cert, root.cert),
+		})...)
+		s.trustAnchor = x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{root.cert})
+		s.replaceTrustAnchors = true
+
+		expTrustAnchors := func(exp []byte) {
+			t.Helper()
+			if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+				t.Fatal(err)
+			}
+			var secret corev1.Secret
+			if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(secret.Data["issuer.crt"], certPEM(issuer.cert)) {
+				t.Error("expected the issuer to be switched")
+			}
+			if !bytes.Equal(secret.Data["ca.crt"], exp) {
+				t.Errorf("unexpected trust bundle %q", secret.Data["ca.crt"])
+			}
+		}
+
+		// The root of the old issuer is kept while the issuer is switched.
+		expTrustAnchors(certPEM(oldRoot.cert, root.cert))
+		// Once the new issuer is in use the old root is removed.
+		expTrustAnchors(certPEM(root.cert))
+	})
+
+	t.Run("missing dapr Secret should record event", func(t *testing.T) {
+		objs := testObjects(t, issuer, root, nil)
+		s, recorder := newTestSecretCtrl(t, now, objs[:2]...)
+
+		if _, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+
+		if events := strings.Join(drainEvents(recorder), "\n"); !strings.Contains(events, reasonTargetSecretMissing) {
+			t.Errorf("expected %s event, got %q", reasonTargetSecretMissing, events)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// labelTrustAnchors is the label of the ConfigMaps which the trust anchors
+	// are distributed to. Only ConfigMaps with this label are cached, updated
+	// or deleted.
+	labelTrustAnchors = "dapr-cert-manager.diagrid.io/trust-anchors"
+
+	// distributionKey is the key of the distributed ConfigMaps containing the
+	// trust anchors.
+	distributionKey = "ca.crt"
+
+	// reasonConfigMapConflict is the reason of the Event recorded on a
+	// namespace which already contains a ConfigMap with the same name, which
+	// was not created by dapr-cert-manager.
+	reasonConfigMapConflict = "TrustAnchorConfigMapConflict"
+)
+
+// DistributionOptions configure AddDistribution.
+type DistributionOptions struct {
+	Log logr.Logger
+
+	// NamespaceSelector selects the namespaces the trust anchors are
+	// distributed to.
+	NamespaceSelector labels.Selector
+
+	// ConfigMapName is the name of the ConfigMap written to each selected
+	// namespace.
+	ConfigMapName string
+
+	// SourceNamespace is the dapr namespace whose `dapr-trust-bundle` Secret
+	// trust anchors are distributed.
+	SourceNamespace string
+
+	// DryRun will log the changes which would be made to the ConfigMaps,
+	// rather than writing them.
+	DryRun bool
+}
+
+// distributionCtrl writes the trust anchors of the dapr trust-bundle Secret to
+// a ConfigMap in every namespace matching a label selector, and deletes the
+// ConfigMap once the namespace no longer matches.
+type distributionCtrl struct {
+	log logr.Logger
+	// client reads Namespaces and ConfigMaps from the cluster wide cache of the
+	// distribution controller.
+	client client.Client
+	// apiReader reads ConfigMaps which are not cached, since they were not
+	// created by dapr-cert-manager.
+	apiReader    client.Reader
+	secretReader client.Reader
+	recorder     record.EventRecorder
+
+	namespaceSelector labels.Selector
+	configMapName     string
+	sourceNamespace   string
+	dryRun            bool
+}
+
+// AddDistribution registers the trust anchor distribution controller with the
+// Manager. Namespaces and ConfigMaps are watched with a cluster wide cache
+// separate to that of the Manager, which is only cluster wide if dapr
+// namespaces are selected by label.
+func AddDistribution(mgr ctrl.Manager, opts DistributionOptions) error {
+	cl, err := cluster.New(mgr.GetConfig(), func(o *cluster.Options) {
+		o.Scheme = mgr.GetScheme()
+		o.Logger = opts.Log.WithName("distribution-cache")
+		o.Cache.ByObject = map[client.Object]cache.ByObject{
+			new(corev1.ConfigMap): {Label: labels.SelectorFromSet(labels.Set{labelTrustAnchors: "true"})},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create distribution cache: %w", err)
+	}
+	if err := mgr.Add(cl); err != nil {
+		return err
+	}
+
+	distCtl := &distributionCtrl{
+		log:               opts.Log.WithName("controller").WithName("distribution"),
+		client:            cl.GetClient(),
+		apiReader:         cl.GetAPIReader(),
+		secretReader:      mgr.GetCache(),
+		recorder:          mgr.GetEventRecorderFor("dapr-cert-manager"),
+		namespaceSelector: opts.NamespaceSelector,
+		configMapName:     opts.ConfigMapName,
+		sourceNamespace:   opts.SourceNamespace,
+		dryRun:            opts.DryRun,
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("distribution").
+
+		// Reconcile a namespace when it is created or its labels change, since
+		// it may have started or stopped matching the selector.
+		WatchesRawSource(source.Kind(cl.GetCache(), client.Object(new(corev1.Namespace)), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				return []ctrl.Request{distCtl.request(obj.GetName())}
+			},
+		))).
+
+		// Reconcile a namespace when its ConfigMap is modified or deleted by
+		// another writer.
+		WatchesRawSource(source.Kind(cl.GetCache(), client.Object(new(corev1.ConfigMap)), handler.EnqueueRequestsFromMapFunc(
+			func(_ context.Context, obj client.Object) []ctrl.Request {
+				return []ctrl.Request{distCtl.request(obj.GetNamespace())}
+			},
+		), predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			return obj.GetName() == distCtl.configMapName
+		}))).
+
+		// Reconcile every namespace when the trust anchors change.
+		Watches(new(corev1.Secret), handler.EnqueueRequestsFromMapFunc(distCtl.allRequests),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				return obj.GetNamespace() == distCtl.sourceNamespace && obj.GetName() == "dapr-trust-bundle"
+			}))).
+		Complete(distCtl)
+}
+
+// request returns the reconcile request of the ConfigMap in the given
+// namespace.
+func (d *distributionCtrl) request(namespace string) ctrl.Request {
+	return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: d.configMapName}}
+}
+
+// allRequests returns the reconcile requests of every namespace which matches
+// the selector.
+func (d *distributionCtrl) allRequests(ctx context.Context, _ client.Object) []ctrl.Request {
+	var nsList corev1.NamespaceList
+	if err := d.client.List(ctx, &nsList, client.MatchingLabelsSelector{Selector: d.namespaceSelector}); err != nil {
+		d.log.Error(err, "failed to list namespaces")
+		return nil
+	}
+
+	requests := make([]ctrl.Request, 0, len(nsList.Items))
+	for _, ns := range nsList.Items {
+		requests = append(requests, d.request(ns.Name))
+	}
+
+	return requests
+}
+
+// Reconcile ensures the ConfigMap in the namespace of the request contains the
+// trust anchors of the dapr trust-bundle Secret if the namespace matches the
+// selector, or that it is deleted if not.
+func (d *distributionCtrl) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := d.log.WithValues("namespace", req.Namespace, "configmap", d.configMapName)
+
+	var ns corev1.Namespace
+	err := d.client.Get(ctx, types.NamespacedName{Name: req.Namespace}, &ns)
+	if apierrors.IsNotFound(err) {
+		// The ConfigMap is deleted with the namespace.
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if ns.DeletionTimestamp != nil {
+		return ctrl.Result{}, nil
+	}
+
+	// Only the ConfigMaps created by dapr-cert-manager are cached.
+	var cm corev1.ConfigMap
+	err = d.client.Get(ctx, req.NamespacedName, &cm)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	exists := err == nil
+
+	if !d.namespaceSelector.Matches(labels.Set(ns.Labels)) {
+		if !exists {
+			return ctrl.Result{}, nil
+		}
+		if d.dryRun {
+			log.Info("dry run: would delete trust anchor ConfigMap from namespace which no longer matches selector")
+			return ctrl.Result{}, nil
+		}
+		log.Info("deleting trust anchor ConfigMap from namespace which no longer matches selector")
+		if err := d.client.Delete(ctx, &cm); err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, fmt.Errorf("failed to delete trust anchor ConfigMap: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	var secret corev1.Secret
+	err = d.secretReader.Get(ctx, types.NamespacedName{Namespace: d.sourceNamespace, Name: "dapr-trust-bundle"}, &secret)
+	if apierrors.IsNotFound(err) {
+		log.V(3).Info("dapr trust-bundle Secret does not exist", "source_namespace", d.sourceNamespace)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if len(secret.Data[v1alpha1.DefaultCAKey]) == 0 {
+		log.V(3).Info("dapr trust-bundle Secret has no trust anchors", "source_namespace", d.sourceNamespace)
+		return ctrl.Result{}, nil
+	}
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data[v1alpha1.DefaultCAKey])
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to parse trust anchors from dapr trust-bundle Secret: %w", err)
+	}
+	taPEM, err := bundle.Marshal()
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to marshal trust anchors: %w", err)
+	}
+
+	if !exists {
+		// A ConfigMap with the same name which was not created by
+		// dapr-cert-manager is not cached, so is read before creating the
+		// ConfigMap. It is never modified.
+		err := d.apiReader.Get(ctx, req.NamespacedName, &cm)
+		if err == nil {
+			if cm.Labels[labelTrustAnchors] != "true" {
+				d.recordConflict(log, &ns)
+			}
+			// Otherwise the ConfigMap was created since the cache was synced, and
+			// is reconciled again once it is observed.
+			return ctrl.Result{}, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: req.Namespace,
+				Name:      d.configMapName,
+				Labels:    map[string]string{labelTrustAnchors: "true"},
+			},
+			Data: map[string]string{distributionKey: string(taPEM)},
+		}
+		if d.dryRun {
+			log.Info("dry run: would create trust anchor ConfigMap")
+			return ctrl.Result{}, nil
+		}
+		log.Info("creating trust anchor ConfigMap")
+		err = d.client.Create(ctx, &cm, client.FieldOwner(fieldManager))
+		if apierrors.IsAlreadyExists(err) {
+			// The ConfigMap was created by another writer since it was read.
+			d.recordConflict(log, &ns)
+			return ctrl.Result{}, nil
+		}
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to create trust anchor ConfigMap: %w", err)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if cm.Data[distributionKey] == string(taPEM) {
+		log.V(3).Info("trust anchor ConfigMap is up to date")
+		return ctrl.Result{}, nil
+	}
+
+	if d.dryRun {
+		log.Info("dry run: would update trust anchor ConfigMap")
+		return ctrl.Result{}, nil
+	}
+
+	orig := cm.DeepCopy()
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[distributionKey] = string(taPEM)
+	log.Info("updating trust anchor ConfigMap")
+	if err := d.client.Patch(ctx, &cm, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to patch trust anchor ConfigMap: %w", err)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// recordConflict records that the trust anchors are not distributed to the
+// given namespace, since it already contains a ConfigMap with the same name
+// which was not created by dapr-cert-manager.
+func (d *distributionCtrl) recordConflict(log logr.Logger, ns *corev1.Namespace) {
+	log.Error(nil, "refusing to overwrite ConfigMap which was not created by dapr-cert-manager, skipping namespace")
+	if d.recorder != nil {
+		d.recorder.Eventf(ns, corev1.EventTypeWarning, reasonConfigMapConflict,
+			"Trust anchors not distributed: ConfigMap %q already exists and was not created by dapr-cert-manager", d.configMapName)
+	}
+}
@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func Test_distributionCtrl(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	newRoot := genCA(t, "new-root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{"dapr-trust": "true"}}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data:       map[string][]byte{"ca.crt": certPEM(root.cert)},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ns, secret).Build()
+
+	d := &distributionCtrl{
+		log:               logr.Discard(),
+		client:            cl,
+		apiReader:         cl,
+		secretReader:      cl,
+		namespaceSelector: labels.SelectorFromSet(labels.Set{"dapr-trust": "true"}),
+		configMapName:     "dapr-trust-anchors",
+		sourceNamespace:   "dapr-system",
+	}
+
+	ctx := context.Background()
+	reconcile := func(namespace string) {
+		t.Helper()
+		if _, err := d.Reconcile(ctx, d.request(namespace)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expConfigMap := func(exp []byte) {
+		t.Helper()
+		var cm corev1.ConfigMap
+		err := cl.Get(ctx, client.ObjectKey{Namespace: "app", Name: "dapr-trust-anchors"}, &cm)
+		if exp == nil {
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("expected ConfigMap to not exist, got %v", err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cm.Data["ca.crt"] != string(exp) {
+			t.Errorf("unexpected trust anchors in ConfigMap: %q", cm.Data["ca.crt"])
+		}
+		if cm.Labels[labelTrustAnchors] != "true" {
+			t.Errorf("expected ConfigMap to have label %s", labelTrustAnchors)
+		}
+	}
+
+	// The trust anchors are written to a namespace matching the selector.
+	reconcile("app")
+	expConfigMap(certPEM(root.cert))
+
+	// The ConfigMap is updated when the trust anchors change.
+	secret.Data["ca.crt"] = append(certPEM(root.cert), certPEM(newRoot.cert)...)
+	if err := cl.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if requests := d.allRequests(ctx, secret); len(requests) != 1 || requests[0] != d.request("app") {
+		t.Errorf("expected request of matching namespace, got %v", requests)
+	}
+	reconcile("app")
+	expConfigMap(append(certPEM(root.cert), certPEM(newRoot.cert)...))
+
+	// The ConfigMap is deleted once the namespace stops matching.
+	ns.Labels = nil
+	if err := cl.Update(ctx, ns); err != nil {
+		t.Fatal(err)
+	}
+	if requests := d.allRequests(ctx, secret); len(requests) != 0 {
+		t.Errorf("expected no requests, got %v", requests)
+	}
+	reconcile("app")
+	expConfigMap(nil)
+
+	// Namespaces which don't exist are ignored.
+	if _, err := d.Reconcile(ctx, ctrl.Request{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_distributionCtrl_noWrites(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "app", Labels: map[string]string{"dapr-trust": "true"}}}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data:       map[string][]byte{"ca.crt": certPEM(root.cert)},
+	}
+	userCM := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "dapr-trust-anchors"},
+		Data:       map[string]string{"ca.crt": "user data"},
+	}
+
+	tests := map[string]struct {
+		objs        []client.Object
+		createErr   error
+		dryRun      bool
+		expData     string
+		expConflict bool
+		expCreate   bool
+	}{
+		"a ConfigMap which was not created by dapr-cert-manager, so is not cached, is not modified": {
+			objs:        []client.Object{userCM},
+			expData:     "user data",
+			expConflict: true,
+		},
+		"a ConfigMap which is created by another writer after it was read is skipped": {
+			createErr:   apierrors.NewAlreadyExists(corev1.Resource("configmaps"), "dapr-trust-anchors"),
+			expConflict: true,
+			expCreate:   true,
+		},
+		"no ConfigMap is created on dry run": {
+			dryRun: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var created bool
+			apiClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(test.objs, ns.DeepCopy(), secret.DeepCopy())...).Build()
+			// The cache of the controller only contains the labelled ConfigMaps.
+			cl := interceptor.NewClient(apiClient, interceptor.Funcs{
+				Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if err := cl.Get(ctx, key, obj, opts...); err != nil {
+						return err
+					}
+					if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Labels[labelTrustAnchors] != "true" {
+						return apierrors.NewNotFound(corev1.Resource("configmaps"), key.Name)
+					}
+					return nil
+				},
+				Create: func(ctx context.Context, cl client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+					created = true
+					if test.createErr != nil {
+						return test.createErr
+					}
+					return cl.Create(ctx, obj, opts...)
+				},
+			})
+			recorder := record.NewFakeRecorder(10)
+
+			d := &distributionCtrl{
+				log:               logr.Discard(),
+				client:            cl,
+				apiReader:         apiClient,
+				secretReader:      cl,
+				recorder:          recorder,
+				namespaceSelector: labels.SelectorFromSet(labels.Set{"dapr-trust": "true"}),
+				configMapName:     "dapr-trust-anchors",
+				sourceNamespace:   "dapr-system",
+				dryRun:            test.dryRun,
+			}
+
+			if _, err := d.Reconcile(context.Background(), d.request("app")); err != nil {
+				t.Fatal(err)
+			}
+
+			if created != test.expCreate {
+				t.Errorf("expected ConfigMap create=%t, got %t", test.expCreate, created)
+			}
+
+			var cm corev1.ConfigMap
+			err := apiClient.Get(context.Background(), client.ObjectKey{Namespace: "app", Name: "dapr-trust-anchors"}, &cm)
+			if len(test.expData) == 0 {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("expected ConfigMap to not exist, got %v", err)
+				}
+			} else if cm.Data["ca.crt"] != test.expData {
+				t.Errorf("unexpected ConfigMap data: %q", cm.Data["ca.crt"])
+			}
+
+			events := strings.Join(drainEvents(recorder), "\n")
+			if strings.Contains(events, reasonConfigMapConflict) != test.expConflict {
+				t.Errorf("expected %s event=%t, got %q", reasonConfigMapConflict, test.expConflict, events)
+			}
+		})
+	}
+}
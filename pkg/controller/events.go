@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"crypto/x509"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Reasons of the Kubernetes Events recorded by the trust-bundle controller.
+const (
+	reasonIssuerRotated        = "IssuerRotated"
+	reasonTrustAnchorsAdded    = "TrustAnchorsAdded"
+	reasonTrustAnchorsPruned   = "TrustAnchorsPruned"
+	reasonTrustAnchorsRemoved  = "TrustAnchorsRemoved"
+	reasonRootRotation         = "RootRotation"
+	reasonWriteFailed          = "WriteFailed"
+	reasonJWTSigningKeyRotated = "JWTSigningKeyRotated"
+	reasonValidationFailed     = "ValidationFailed"
+	reasonSourceSecretEmpty    = "SourceSecretEmpty"
+	reasonTargetSecretMissing  = "TargetSecretMissing"
+	reasonSecretBootstrapped   = "SecretBootstrapped"
+	reasonTargetConflict       = "TargetConflict"
+)
+
+// recordEvent records an Event with the given type, reason and message on
+// all of the given objects. Nil objects are skipped, and no Events are
+// recorded if the controller has no recorder.
+func (s *secretCtrl) recordEvent(eventType, reason, message string, objs ...runtime.Object) {
+	if s.recorder == nil {
+		return
+	}
+	for _, obj := range objs {
+		if obj != nil {
+			s.recorder.Event(obj, eventType, reason, message)
+		}
+	}
+}
+
+// recordIssuerRotated records that the dapr issuer has been rotated.
+func (s *secretCtrl) recordIssuerRotated(update *bundleUpdate, objs ...runtime.Object) {
+	if update.issuer == nil {
+		return
+	}
+
+	from := "none"
+	if update.previousIssuer != nil {
+		from = describeCertificate(update.previousIssuer)
+	}
+
+	s.recordEvent(corev1.EventTypeNormal, reasonIssuerRotated,
+		fmt.Sprintf("Issuer rotated from [%s] to [%s]", from, describeCertificate(update.issuer)), objs...)
+}
+
+// recordTrustAnchorChanges records the trust anchors which have been added
+// to, pruned from, and removed from the dapr trust bundle.
+func (s *secretCtrl) recordTrustAnchorChanges(update *bundleUpdate, objs ...runtime.Object) {
+	if len(update.added) > 0 {
+		s.recordEvent(corev1.EventTypeNormal, reasonTrustAnchorsAdded,
+			fmt.Sprintf("Added %d trust anchor(s): %s", len(update.added), describeCertificates(update.added)), objs...)
+	}
+	if len(update.pruned) > 0 {
+		s.recordEvent(corev1.EventTypeNormal, reasonTrustAnchorsPruned,
+			fmt.Sprintf("Pruned %d expired trust anchor(s): %s", len(update.pruned), describeCertificates(update.pruned)), objs...)
+	}
+	if len(update.removed) > 0 {
+		s.recordEvent(corev1.EventTypeNormal, reasonTrustAnchorsRemoved,
+			fmt.Sprintf("Removed %d trust anchor(s): %s", len(update.removed), describeCertificates(update.removed)), objs...)
+	}
+}
+
+// recordRootRotation records that a root CA rotation has entered a new phase.
+func (s *secretCtrl) recordRootRotation(status *rotationStatus, objs ...runtime.Object) {
+	s.recordEvent(corev1.EventTypeNormal, reasonRootRotation,
+		fmt.Sprintf("Root CA rotation to sha256=%s entered phase %s", status.NewRoot, status.Phase), objs...)
+}
+
+// describeCertificate returns a short human readable description of the
+// given certificate which identifies it by serial and fingerprint.
+func describeCertificate(cert *x509.Certificate) string {
+	return fmt.Sprintf("subject=%q serial=%s sha256=%s", cert.Subject.String(), cert.SerialNumber.String(), fingerprint(cert))
+}
+
+// describeCertificates returns a short human readable description of all the
+// given certificates.
+func describeCertificates(certs []*x509.Certificate) string {
+	descs := make([]string, len(certs))
+	for i, cert := range certs {
+		descs[i] = "[" + describeCertificate(cert) + "]"
+	}
+	return strings.Join(descs, ", ")
+}
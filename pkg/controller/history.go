@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// AnnotationPaused pauses the reconciliation of a dapr certificate Secret
+	// when set to "true" on it. Set by rollbacks, and removed by the user to
+	// resume reconciliation.
+	AnnotationPaused = "dapr-cert-manager.diagrid.io/paused"
+
+	// labelHistoryOf is the label of a history Secret whose value is the name
+	// of the dapr certificate Secret it is a revision of.
+	labelHistoryOf = "dapr-cert-manager.diagrid.io/history-of"
+
+	// labelRevision is the label of a history Secret whose value is its
+	// revision number.
+	labelRevision = "dapr-cert-manager.diagrid.io/revision"
+
+	// annotationHistoryTarget is the annotation of a history Secret whose
+	// value is the JSON encoded historyTarget the revision is restored to.
+	annotationHistoryTarget = "dapr-cert-manager.diagrid.io/history-target"
+
+	// Keys of the history Secret data.
+	historyIssuerKey     = "issuer.crt"
+	historyPrivateKeyKey = "issuer.key"
+	historyCAKey         = "ca.crt"
+
+	// writeStepHistory is the step of saving the previous values of the dapr
+	// Secrets to the history.
+	writeStepHistory = "history"
+)
+
+// historyTarget is the dapr Secrets and keys which a revision was saved from.
+type historyTarget struct {
+	CertSecretName string `json:"certSecretName"`
+	CASecretName   string `json:"caSecretName,omitempty"`
+	CertKey        string `json:"certKey"`
+	PrivateKeyKey  string `json:"privateKeyKey"`
+	CAKey          string `json:"caKey,omitempty"`
+}
+
+// Revision is a saved revision of the issuer and trust bundle of a dapr
+// certificate Secret. Certificates are summarised, and never contain PEM data.
+type Revision struct {
+	// Revision is the revision number. Higher revisions are more recent.
+	Revision int `json:"revision"`
+
+	// Name is the name of the history Secret of the revision.
+	Name string `json:"name"`
+
+	// CreationTime is the time the revision was saved.
+	CreationTime time.Time `json:"creationTime"`
+
+	// Issuer is the issuer certificate of the revision. Nil if there was no
+	// valid issuer.
+	Issuer *CertificateSummary `json:"issuer,omitempty"`
+
+	// TrustAnchors are the trust anchors of the revision.
+	TrustAnchors []CertificateSummary `json:"trustAnchors,omitempty"`
+}
+
+// saveHistory saves the current issuer and trust bundle of the dapr Secrets as
+// a new revision, before they are overwritten. No revision is saved if the
+// dapr Secrets are empty, or if the latest revision has the same data.
+// Revisions are saved in historyLimit fixed history Secrets, named
+// `<secret>-history-<slot>`, with the oldest revision overwritten in place, so
+// that the history Secrets can be restricted by name with RBAC.
+func (s *secretCtrl) saveHistory(ctx context.Context, log logr.Logger, namespace string, conf secretConf, daprCertSecret, daprCASecret corev1.Secret) error {
+	data := map[string][]byte{
+		historyIssuerKey:     daprCertSecret.Data[conf.certSectretKey],
+		historyPrivateKeyKey: daprCertSecret.Data[conf.certSecretPKKey],
+	}
+	if len(conf.caSecretName) > 0 {
+		data[historyCAKey] = daprCASecret.Data[conf.certSecretCAKey]
+	}
+
+	var empty = true
+	for key, value := range data {
+		if len(value) == 0 {
+			delete(data, key)
+			continue
+		}
+		empty = false
+	}
+	if empty {
+		return nil
+	}
+
+	history, err := getHistory(ctx, s.apiReader, namespace, conf.certSecretName, s.historyLimit)
+	if err != nil {
+		return err
+	}
+
+	if len(history) > 0 && historyDataEqual(history[len(history)-1].Data, data) {
+		return nil
+	}
+
+	revision := 1
+	if len(history) > 0 {
+		revision = historyRevision(history[len(history)-1]) + 1
+	}
+
+	target, err := json.Marshal(historyTarget{
+		CertSecretName: conf.certSecretName,
+		CASecretName:   conf.caSecretName,
+		CertKey:        conf.certSectretKey,
+		PrivateKeyKey:  conf.certSecretPKKey,
+		CAKey:          conf.certSecretCAKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal history target: %w", err)
+	}
+
+	name := historySecretName(conf.certSecretName, (revision-1)%s.historyLimit)
+	labels := map[string]string{
+		labelHistoryOf: conf.certSecretName,
+		labelRevision:  strconv.Itoa(revision),
+	}
+	annotations := map[string]string{
+		annotationHistoryTarget: string(target),
+	}
+
+	var secret corev1.Secret
+	err = s.apiReader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   namespace,
+				Name:        name,
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Data: data,
+		}
+		if err := s.client.Create(ctx, &secret, client.FieldOwner(fieldManager)); err != nil {
+			return fmt.Errorf("failed to create history Secret: %w", err)
+		}
+
+	case err != nil:
+		return fmt.Errorf("failed to get history Secret: %w", err)
+
+	case secret.Labels[labelHistoryOf] != conf.certSecretName:
+		return fmt.Errorf("refusing to overwrite Secret %q which is not a history Secret of %q", name, conf.certSecretName)
+
+	default:
+		orig := secret.DeepCopy()
+		secret.Labels, secret.Annotations, secret.Data = labels, annotations, data
+		if err := s.client.Patch(ctx, &secret, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+			return fmt.Errorf("failed to update history Secret: %w", err)
+		}
+	}
+	log.Info("saved dapr Secret revision", "revision", revision, "history_secret", secret.Name)
+
+	return nil
+}
+
+// historySecretName returns the name of the history Secret of the given dapr
+// certificate Secret which holds the revisions of the given slot.
+func historySecretName(secretName string, slot int) string {
+	return fmt.Sprintf("%s-history-%d", secretName, slot)
+}
+
+// getHistory returns the history Secrets of the given dapr certificate
+// Secret, ordered by revision oldest first. History Secrets are read by name
+// from the first slot until limit, or until one does not exist. If limit is
+// not positive, all existing slots are read.
+func getHistory(ctx context.Context, reader client.Reader, namespace, secretName string, limit int) ([]corev1.Secret, error) {
+	var history []corev1.Secret
+	for slot := 0; limit <= 0 || slot < limit; slot++ {
+		var secret corev1.Secret
+		err := reader.Get(ctx, client.ObjectKey{Namespace: namespace, Name: historySecretName(secretName, slot)}, &secret)
+		if apierrors.IsNotFound(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get history Secret: %w", err)
+		}
+		if secret.Labels[labelHistoryOf] != secretName {
+			// Not a history Secret written by dapr-cert-manager.
+			break
+		}
+		history = append(history, secret)
+	}
+
+	sort.Slice(history, func(i, j int) bool {
+		return historyRevision(history[i]) < historyRevision(history[j])
+	})
+
+	return history, nil
+}
+
+// historyRevision returns the revision number of the given history Secret.
+// Returns 0 if the revision label is invalid.
+func historyRevision(secret corev1.Secret) int {
+	revision, _ := strconv.Atoi(secret.Labels[labelRevision])
+	return revision
+}
+
+// historyDataEqual returns true if the given history Secret data are equal.
+func historyDataEqual(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if !bytes.Equal(value, b[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+// History returns the saved revisions of the given dapr certificate Secret,
+// ordered by revision oldest first.
+func History(ctx context.Context, reader client.Reader, namespace, secretName string) ([]Revision, error) {
+	history, err := getHistory(ctx, reader, namespace, secretName, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := make([]Revision, 0, len(history))
+	for _, secret := range history {
+		revision := Revision{
+			Revision:     historyRevision(secret),
+			Name:         secret.Name,
+			CreationTime: secret.CreationTimestamp.UTC(),
+		}
+		if chain, err := parseCertificates(secret.Data[historyIssuerKey]); err == nil {
+			issuer := summarizeCertificate(chain[0])
+			revision.Issuer = &issuer
+		}
+		if bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data[historyCAKey]); err == nil {
+			for _, cert := range bundle.X509Authorities() {
+				revision.TrustAnchors = append(revision.TrustAnchors, summarizeCertificate(cert))
+			}
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// Rollback restores the issuer and trust bundle of the given revision of the
+// dapr certificate Secret, and pauses its reconciliation so that the restored
+// revision is not overwritten. Reconciliation is paused first, then the trust
+// bundle is restored before the issuer, so that the restored issuer is never
+// served before the trust anchors it chains to.
+func Rollback(ctx context.Context, cl client.Client, namespace, secretName string, revision int) error {
+	history, err := getHistory(ctx, cl, namespace, secretName, 0)
+	if err != nil {
+		return err
+	}
+
+	var backup *corev1.Secret
+	for i := range history {
+		if historyRevision(history[i]) == revision {
+			backup = &history[i]
+			break
+		}
+	}
+	if backup == nil {
+		return fmt.Errorf("revision %d of dapr Secret %s/%s does not exist", revision, namespace, secretName)
+	}
+
+	var target historyTarget
+	if err := json.Unmarshal([]byte(backup.Annotations[annotationHistoryTarget]), &target); err != nil {
+		return fmt.Errorf("failed to parse history target of %s: %w", backup.Name, err)
+	}
+
+	var certSecret corev1.Secret
+	if err := cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: target.CertSecretName}, &certSecret); err != nil {
+		return fmt.Errorf("failed to get dapr certificate Secret: %w", err)
+	}
+
+	restoreCA := len(target.CASecretName) > 0 && len(backup.Data[historyCAKey]) > 0
+	if restoreCA && target.CASecretName != target.CertSecretName {
+		orig := certSecret.DeepCopy()
+		if certSecret.Annotations == nil {
+			certSecret.Annotations = make(map[string]string)
+		}
+		certSecret.Annotations[AnnotationPaused] = "true"
+		if err := cl.Patch(ctx, &certSecret, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+			return fmt.Errorf("failed to pause dapr certificate Secret: %w", err)
+		}
+
+		var caSecret corev1.Secret
+		if err := cl.Get(ctx, client.ObjectKey{Namespace: namespace, Name: target.CASecretName}, &caSecret); err != nil {
+			return fmt.Errorf("failed to get dapr CA Secret: %w", err)
+		}
+		orig = caSecret.DeepCopy()
+		if caSecret.Data == nil {
+			caSecret.Data = make(map[string][]byte)
+		}
+		caSecret.Data[target.CAKey] = backup.Data[historyCAKey]
+		if err := cl.Patch(ctx, &caSecret, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+			return fmt.Errorf("failed to restore dapr CA Secret: %w", err)
+		}
+	}
+
+	orig := certSecret.DeepCopy()
+	if certSecret.Annotations == nil {
+		certSecret.Annotations = make(map[string]string)
+	}
+	certSecret.Annotations[AnnotationPaused] = "true"
+	if certSecret.Data == nil {
+		certSecret.Data = make(map[string][]byte)
+	}
+	for key, historyKey := range map[string]string{target.CertKey: historyIssuerKey, target.PrivateKeyKey: historyPrivateKeyKey} {
+		if value, ok := backup.Data[historyKey]; ok {
+			certSecret.Data[key] = value
+		}
+	}
+	if restoreCA && target.CASecretName == target.CertSecretName {
+		certSecret.Data[target.CAKey] = backup.Data[historyCAKey]
+	}
+	if err := cl.Patch(ctx, &certSecret, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+		return fmt.Errorf("failed to restore dapr certificate Secret: %w", err)
+	}
+
+	return nil
+}
+
+// paused returns true if reconciliation of the given dapr Secret is paused.
+func paused(secret corev1.Secret) bool {
+	return secret.Annotations[AnnotationPaused] == "true"
+}
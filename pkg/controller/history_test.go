@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func Test_history(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer1 := genCA(t, "issuer-1", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	issuer2 := genCA(t, "issuer-2", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	issuer3 := genCA(t, "issuer-3", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	objs := testObjects(t, issuer2, root, map[string][]byte{
+		"issuer.crt": certPEM(issuer1.cert),
+		"issuer.key": keyPEM(t, issuer1.key),
+		"ca.crt":     certPEM(root.cert),
+	})
+	cmSecret := objs[1].(*corev1.Secret)
+	s, _ := newTestSecretCtrl(t, now, objs...)
+	s.historyLimit = 1
+
+	ctx := context.Background()
+	reconcile := func() {
+		t.Helper()
+		if _, err := s.reconcileBundle(ctx, s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expIssuer := func(exp *testCA) {
+		t.Helper()
+		var secret corev1.Secret
+		if err := s.client.Get(ctx, client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(secret.Data["issuer.crt"], certPEM(exp.cert)) {
+			t.Errorf("expected issuer %q in dapr Secret", exp.cert.Subject.CommonName)
+		}
+	}
+
+	expRevisions := func(exp ...int) {
+		t.Helper()
+		revisions, err := History(ctx, s.client, "dapr-system", "dapr-trust-bundle")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != len(exp) {
+			t.Fatalf("expected revisions %v, got %d revisions", exp, len(revisions))
+		}
+		for i, revision := range revisions {
+			if revision.Revision != exp[i] {
+				t.Errorf("expected revisions %v, got revision %d at %d", exp, revision.Revision, i)
+			}
+			// Revisions are saved in place in the fixed history Secrets.
+			if exp := "dapr-trust-bundle-history-0"; revision.Name != exp {
+				t.Errorf("expected revision %d in history Secret %q, got %q", revision.Revision, exp, revision.Name)
+			}
+		}
+	}
+
+	// The previous issuer is saved before it is overwritten.
+	reconcile()
+	expIssuer(issuer2)
+	expRevisions(1)
+
+	// An up to date dapr Secret does not create a revision.
+	reconcile()
+	expRevisions(1)
+
+	// The oldest revision is overwritten beyond the history limit.
+	cmSecret.Data["tls.crt"] = certPEM(issuer3.cert)
+	cmSecret.Data["tls.key"] = keyPEM(t, issuer3.key)
+	if err := s.client.Update(ctx, cmSecret); err != nil {
+		t.Fatal(err)
+	}
+	reconcile()
+	expIssuer(issuer3)
+	expRevisions(2)
+
+	if err := Rollback(ctx, s.client, "dapr-system", "dapr-trust-bundle", 1); err == nil {
+		t.Error("expected error rolling back to overwritten revision")
+	}
+
+	// A rollback restores the revision, and pauses reconciliation.
+	if err := Rollback(ctx, s.client, "dapr-system", "dapr-trust-bundle", 2); err != nil {
+		t.Fatal(err)
+	}
+	expIssuer(issuer2)
+	reconcile()
+	expIssuer(issuer2)
+	expRevisions(2)
+}
+
+func Test_Rollback_writeOrder(t *testing.T) {
+	target, err := json.Marshal(historyTarget{
+		CertSecretName: "dapr-issuer",
+		CASecretName:   "dapr-ca",
+		CertKey:        "issuer.crt",
+		PrivateKeyKey:  "issuer.key",
+		CAKey:          "ca.crt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newTestSecretCtrl(t, time.Now())
+
+	var patches []string
+	cl := fake.NewClientBuilder().WithScheme(s.client.Scheme()).WithObjects(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-issuer"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-ca"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "dapr-system",
+				Name:        "dapr-issuer-history-0",
+				Labels:      map[string]string{labelHistoryOf: "dapr-issuer", labelRevision: "1"},
+				Annotations: map[string]string{annotationHistoryTarget: string(target)},
+			},
+			Data: map[string][]byte{"issuer.crt": []byte("issuer"), "issuer.key": []byte("key"), "ca.crt": []byte("ca")},
+		},
+	).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			secret := obj.(*corev1.Secret)
+			switch {
+			case len(secret.Data["issuer.crt"]) > 0:
+				patches = append(patches, "issuer")
+			case len(secret.Data["ca.crt"]) > 0:
+				patches = append(patches, "ca")
+			case paused(*secret):
+				patches = append(patches, "pause")
+			}
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+
+	if err := Rollback(context.Background(), cl, "dapr-system", "dapr-issuer", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reconciliation is paused first, and the trust bundle is restored before
+	// the issuer.
+	if exp := []string{"pause", "ca", "issuer"}; !reflect.DeepEqual(patches, exp) {
+		t.Errorf("unexpected patches, exp=%v got=%v", exp, patches)
+	}
+}
+
+func Test_saveHistory_notHistorySecret(t *testing.T) {
+	s, _ := newTestSecretCtrl(t, time.Now(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle-history-0"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	})
+	s.historyLimit = 1
+
+	daprSecret := corev1.Secret{Data: map[string][]byte{"issuer.crt": []byte("issuer")}}
+	if err := s.saveHistory(context.Background(), s.log, "dapr-system", testSecretConf, daprSecret, daprSecret); err == nil {
+		t.Error("expected error overwriting Secret which is not a history Secret")
+	}
+
+	var secret corev1.Secret
+	if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle-history-0"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["password"]) != "hunter2" {
+		t.Error("expected Secret which is not a history Secret to be left untouched")
+	}
+}
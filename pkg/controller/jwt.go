@@ -0,0 +1,351 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// jwtSecretName is the name of the dapr Secret containing the JWT signing
+	// key and JWKS of dapr Sentry.
+	jwtSecretName = "dapr-trust-bundle"
+
+	// jwtSigningKeyKey is the key of the dapr Secret containing the PEM
+	// encoded private key dapr Sentry signs JWTs with.
+	jwtSigningKeyKey = "jwt.key"
+
+	// jwksKey is the key of the dapr Secret containing the JWKS which JWTs
+	// issued by dapr Sentry are verified with.
+	jwksKey = "jwks.json"
+
+	// annotationJWKSRetired is the annotation of the dapr Secret which
+	// persists the time each key of the JWKS stopped being the signing key, as
+	// a JSON map of key ID to time.
+	annotationJWKSRetired = "dapr-cert-manager.diagrid.io/jwks-retired"
+
+	// Steps of writing the JWT signing key to the dapr Secret.
+	writeStepJWKS          = "jwks"
+	writeStepJWTSigningKey = "jwt_signing_key"
+)
+
+// reconcileJWT ensures the dapr Secret contains the JWT signing key from the
+// private key of the JWT signing cert-manager Certificate, and that the JWKS
+// contains its public key. Public keys of previous signing keys are kept in
+// the JWKS, and are pruned once they were retired longer than the JWKS prune
+// grace period ago. The JWKS is always written, and read back, before the
+// signing key so that JWTs are never signed with a key which is not yet
+// trusted. Returns a non-zero duration if the dapr Secret must be reconciled
+// again after it to prune the JWKS.
+func (s *secretCtrl) reconcileJWT(ctx context.Context, log logr.Logger, namespace string) (time.Duration, error) {
+	log = log.WithValues("cert_name", s.jwtCertName, "dapr_namespace", namespace)
+	dbg := log.V(3)
+
+	var cert cmapi.Certificate
+	err := s.lister.Get(ctx, types.NamespacedName{Namespace: namespace, Name: s.jwtCertName}, &cert)
+	if apierrors.IsNotFound(err) {
+		dbg.Info("JWT signing cert-manager Certificate resource does not exist")
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var cmSecret corev1.Secret
+	err = s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: cert.Spec.SecretName}, &cmSecret)
+	if apierrors.IsNotFound(err) {
+		dbg.Info("JWT signing cert-manager Secret does not exist", "secret", cert.Spec.SecretName)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	keyPEM := cmSecret.Data[corev1.TLSPrivateKeyKey]
+	if len(keyPEM) == 0 {
+		dbg.Info("JWT signing cert-manager Secret has no data")
+		s.recordEvent(corev1.EventTypeWarning, reasonSourceSecretEmpty,
+			fmt.Sprintf("cert-manager Secret %q has no JWT signing private key", cmSecret.Name), &cert)
+		return 0, nil
+	}
+
+	signingKey, err := parseSigningKey(keyPEM)
+	if err != nil {
+		log.Error(err, "refusing to update dapr JWT signing key")
+		return 0, err
+	}
+	keyID := s.jwtFixedKeyID
+	if len(keyID) == 0 {
+		keyID, err = jwtKeyID(signingKey.Public())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var daprSecret corev1.Secret
+	err = s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: jwtSecretName}, &daprSecret)
+	if apierrors.IsNotFound(err) {
+		log.Error(err, "dapr JWT Secret does not exist")
+		s.recordEvent(corev1.EventTypeWarning, reasonTargetSecretMissing,
+			fmt.Sprintf("dapr JWT Secret %q does not exist", jwtSecretName), &cert)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if paused(daprSecret) {
+		log.Info("reconciliation of dapr JWT Secret is paused", "annotation", AnnotationPaused)
+		return 0, nil
+	}
+
+	currentJWKS, retired, err := jwksFromSecret(log, daprSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	jwks, retired, requeueAfter := s.desiredJWKS(log, currentJWKS, retired, keyID, signingKey.Public())
+
+	retiredJSON, err := json.Marshal(retired)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal JWKS retired annotation: %w", err)
+	}
+
+	jwksPending := !jwks.Equal(currentJWKS) || daprSecret.Annotations[annotationJWKSRetired] != string(retiredJSON)
+	keyPending := string(daprSecret.Data[jwtSigningKeyKey]) != string(keyPEM)
+	if !jwksPending && !keyPending {
+		log.Info("dapr JWT signing key and JWKS are up to date")
+		return requeueAfter, nil
+	}
+
+	if s.dryRun {
+		log.Info("dry-run: not updating dapr JWT signing key and JWKS", "key_id", keyID, "jwks_pending", jwksPending, "signing_key_pending", keyPending)
+		return requeueAfter, nil
+	}
+
+	log.Info("updating dapr JWT signing key and JWKS", "key_id", keyID)
+
+	if jwksPending {
+		err := s.patchJWKS(ctx, log, &daprSecret, jwks, retiredJSON, keyID, signingKey.Public())
+		if err := s.observeWriteStep(log, namespace, jwtSecretName, writeStepJWKS, err, &daprSecret, &cert); err != nil {
+			return 0, err
+		}
+		updatesTotal.WithLabelValues(namespace, jwtSecretName).Inc()
+	}
+
+	if keyPending {
+		err := s.verifyJWKS(ctx, client.ObjectKeyFromObject(&daprSecret), keyID)
+		if err := s.observeWriteStep(log, namespace, jwtSecretName, writeStepVerify, err, &daprSecret, &cert); err != nil {
+			return 0, err
+		}
+
+		_, err = s.patchSecretData(ctx, &daprSecret, map[string][]byte{jwtSigningKeyKey: keyPEM})
+		if err := s.observeWriteStep(log, namespace, jwtSecretName, writeStepJWTSigningKey, err, &daprSecret, &cert); err != nil {
+			return 0, err
+		}
+		if !jwksPending {
+			updatesTotal.WithLabelValues(namespace, jwtSecretName).Inc()
+		}
+
+		s.recordEvent(corev1.EventTypeNormal, reasonJWTSigningKeyRotated,
+			fmt.Sprintf("JWT signing key rotated to kid=%s", keyID), &daprSecret, &cert)
+	}
+
+	return requeueAfter, nil
+}
+
+// desiredJWKS returns the JWKS containing the public key of the current
+// signing key, appended to the current JWKS. Every other key is recorded as
+// retired, and pruned once it was retired longer than the JWKS prune grace
+// period ago. Also returns the retired times of the keys remaining in the
+// JWKS, and the duration until the next key is due to be pruned.
+func (s *secretCtrl) desiredJWKS(log logr.Logger, current *jwtbundle.Bundle, retired map[string]time.Time, keyID string, publicKey crypto.PublicKey) (*jwtbundle.Bundle, map[string]time.Time, time.Duration) {
+	now := s.clock.Now()
+
+	// The public key is replaced if the key ID is fixed and the signing key
+	// has changed. Never fails since the key ID is not empty.
+	jwks := current.Clone()
+	_ = jwks.AddJWTAuthority(keyID, publicKey)
+
+	nextRetired := make(map[string]time.Time)
+	var requeueAfter time.Duration
+	for id := range jwks.JWTAuthorities() {
+		if id == keyID {
+			continue
+		}
+
+		retiredAt, ok := retired[id]
+		if !ok {
+			retiredAt = now
+		}
+
+		if s.jwksPruneGracePeriod > 0 {
+			pruneAt := retiredAt.Add(s.jwksPruneGracePeriod)
+			if !now.Before(pruneAt) {
+				log.Info("pruning retired key from dapr JWKS", "key_id", id, "retired", retiredAt)
+				jwks.RemoveJWTAuthority(id)
+				continue
+			}
+			if wait := pruneAt.Sub(now); requeueAfter == 0 || wait < requeueAfter {
+				requeueAfter = wait
+			}
+		}
+
+		nextRetired[id] = retiredAt
+	}
+
+	return jwks, nextRetired, requeueAfter
+}
+
+// jwksFromSecret returns the JWKS of the dapr Secret, and the retired times of
+// its keys. An invalid retired annotation is ignored.
+func jwksFromSecret(log logr.Logger, secret corev1.Secret) (*jwtbundle.Bundle, map[string]time.Time, error) {
+	jwks := jwtbundle.New(spiffeid.TrustDomain{})
+	if len(secret.Data[jwksKey]) > 0 {
+		var err error
+		jwks, err = jwtbundle.Parse(spiffeid.TrustDomain{}, secret.Data[jwksKey])
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse JWKS from dapr Secret: %w", err)
+		}
+	}
+
+	retired := make(map[string]time.Time)
+	if value, ok := secret.Annotations[annotationJWKSRetired]; ok {
+		if err := json.Unmarshal([]byte(value), &retired); err != nil {
+			log.Error(err, "ignoring invalid JWKS retired annotation", "annotation", annotationJWKSRetired)
+			retired = make(map[string]time.Time)
+		}
+	}
+
+	return jwks, retired, nil
+}
+
+// patchJWKS patches the JWKS key and retired annotation of the dapr Secret.
+// The patch is conditional on the resourceVersion of the Secret so that keys
+// written concurrently are never lost. On conflict, the latest Secret is read
+// and the desired JWKS recomputed from its JWKS with the given signing key,
+// up to a bounded number of retries.
+func (s *secretCtrl) patchJWKS(ctx context.Context, log logr.Logger, secret *corev1.Secret, jwks *jwtbundle.Bundle, retiredJSON []byte, keyID string, publicKey crypto.PublicKey) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		jwksJSON, err := jwks.Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to marshal JWKS: %w", err)
+		}
+
+		orig := secret.DeepCopy()
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[jwksKey] = jwksJSON
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[annotationJWKSRetired] = string(retiredJSON)
+
+		patchErr := s.client.Patch(ctx, secret, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager))
+		if !apierrors.IsConflict(patchErr) {
+			return patchErr
+		}
+
+		// Re-apply the signing key to the latest JWKS before retrying.
+		var latest corev1.Secret
+		if err := s.apiReader.Get(ctx, client.ObjectKeyFromObject(secret), &latest); err != nil {
+			return err
+		}
+		*secret = latest
+		current, retired, err := jwksFromSecret(log, latest)
+		if err != nil {
+			return err
+		}
+		jwks, retired, _ = s.desiredJWKS(log, current, retired, keyID, publicKey)
+		if retiredJSON, err = json.Marshal(retired); err != nil {
+			return fmt.Errorf("failed to marshal JWKS retired annotation: %w", err)
+		}
+
+		return patchErr
+	})
+}
+
+// verifyJWKS reads back the dapr Secret with the given key, and verifies that
+// its JWKS contains the given key ID.
+func (s *secretCtrl) verifyJWKS(ctx context.Context, key client.ObjectKey, keyID string) error {
+	var secret corev1.Secret
+	if err := s.apiReader.Get(ctx, key, &secret); err != nil {
+		return fmt.Errorf("failed to read back dapr Secret: %w", err)
+	}
+
+	jwks, err := jwtbundle.Parse(spiffeid.TrustDomain{}, secret.Data[jwksKey])
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS from dapr Secret: %w", err)
+	}
+	if !jwks.HasJWTAuthority(keyID) {
+		return fmt.Errorf("JWT signing key kid=%s is missing from dapr JWKS", keyID)
+	}
+
+	return nil
+}
+
+// parseSigningKey parses a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key
+// which can be used to sign JWTs.
+func parseSigningKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("failed to decode JWT signing key PEM")
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing key PEM type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse JWT signing key: %w", err)
+	}
+
+	switch key := key.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey, ed25519.PrivateKey:
+		return key.(crypto.Signer), nil
+	default:
+		return nil, fmt.Errorf("unsupported JWT signing key type %T", key)
+	}
+}
+
+// jwtKeyID returns the key ID of the given public key; its base64url encoded
+// RFC 7638 JWK SHA-256 thumbprint, the standard key ID of a key which has
+// none.
+func jwtKeyID(publicKey crypto.PublicKey) (string, error) {
+	thumbprint, err := (&jose.JSONWebKey{Key: publicKey}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("failed to compute JWK thumbprint of JWT signing public key: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(thumbprint), nil
+}
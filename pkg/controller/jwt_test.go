@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-jose/go-jose/v4"
+	josejwt "github.com/go-jose/go-jose/v4/jwt"
+	"github.com/spiffe/go-spiffe/v2/bundle/jwtbundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/jwtsvid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2/klogr"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func Test_reconcileJWT(t *testing.T) {
+	now := time.Now()
+	grace := time.Hour
+
+	genKey := func() (*ecdsa.PrivateKey, string) {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := jwtKeyID(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, keyID
+	}
+	key1, keyID1 := genKey()
+	key2, keyID2 := genKey()
+
+	cmSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-jwt"},
+		Data:       map[string][]byte{"tls.key": keyPEM(t, key1)},
+	}
+	s, _ := newTestSecretCtrl(t, now,
+		&cmapi.Certificate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-jwt"},
+			Spec:       cmapi.CertificateSpec{SecretName: "dapr-jwt"},
+		},
+		cmSecret,
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"}},
+	)
+	s.jwtCertName = "dapr-jwt"
+	s.jwksPruneGracePeriod = grace
+	fakeClock := s.clock.(*clocktesting.FakePassiveClock)
+
+	expState := func(expKey *ecdsa.PrivateKey, expRequeue time.Duration, expKeyIDs ...string) {
+		t.Helper()
+
+		requeue, err := s.reconcileJWT(context.Background(), s.log, "dapr-system")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requeue != expRequeue {
+			t.Errorf("expected requeue after %s, got %s", expRequeue, requeue)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+		if string(secret.Data["jwt.key"]) != string(keyPEM(t, expKey)) {
+			t.Error("unexpected JWT signing key in dapr Secret")
+		}
+
+		jwks, err := jwtbundle.Parse(spiffeid.TrustDomain{}, secret.Data["jwks.json"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keyIDs []string
+		for keyID := range jwks.JWTAuthorities() {
+			keyIDs = append(keyIDs, keyID)
+		}
+		sort.Strings(keyIDs)
+		sort.Strings(expKeyIDs)
+		if len(keyIDs) != len(expKeyIDs) {
+			t.Fatalf("unexpected JWKS key IDs, exp=%v got=%v", expKeyIDs, keyIDs)
+		}
+		for i := range keyIDs {
+			if keyIDs[i] != expKeyIDs[i] {
+				t.Errorf("unexpected JWKS key IDs, exp=%v got=%v", expKeyIDs, keyIDs)
+			}
+		}
+	}
+
+	expState(key1, 0, keyID1)
+
+	// The previous key is kept in the JWKS after the signing key is rotated.
+	cmSecret.Data["tls.key"] = keyPEM(t, key2)
+	if err := s.client.Update(context.Background(), cmSecret); err != nil {
+		t.Fatal(err)
+	}
+	expState(key2, grace, keyID1, keyID2)
+
+	fakeClock.SetTime(now.Add(time.Minute))
+	expState(key2, grace-time.Minute, keyID1, keyID2)
+
+	// The previous key is pruned once the grace period has passed.
+	fakeClock.SetTime(now.Add(grace))
+	expState(key2, 0, keyID2)
+}
+
+func Test_patchJWKS(t *testing.T) {
+	now := time.Now()
+
+	genKey := func() (*ecdsa.PrivateKey, string) {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyID, err := jwtKeyID(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, keyID
+	}
+	key1, keyID1 := genKey()
+	key2, keyID2 := genKey()
+	concurrentKey, concurrentKeyID := genKey()
+
+	jwksJSON := func(keys map[string]*ecdsa.PrivateKey) []byte {
+		t.Helper()
+		jwks := jwtbundle.New(spiffeid.TrustDomain{})
+		for keyID, key := range keys {
+			if err := jwks.AddJWTAuthority(keyID, key.Public()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		b, err := jwks.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	var patches int
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data:       map[string][]byte{"jwks.json": jwksJSON(map[string]*ecdsa.PrivateKey{keyID1: key1})},
+	}).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			if patches == 1 {
+				// Another writer adds a key before the first patch.
+				var secret corev1.Secret
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), &secret); err != nil {
+					return err
+				}
+				secret.Data["jwks.json"] = jwksJSON(map[string]*ecdsa.PrivateKey{keyID1: key1, concurrentKeyID: concurrentKey})
+				if err := cl.Update(ctx, &secret); err != nil {
+					return err
+				}
+			}
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+
+	s := &secretCtrl{
+		log: klogr.New(), apiReader: cl, secretReader: cl, client: cl,
+		clock: clocktesting.NewFakePassiveClock(now), jwksPruneGracePeriod: time.Hour,
+	}
+
+	var secret corev1.Secret
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	current, retired, err := jwksFromSecret(s.log, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, retired, _ := s.desiredJWKS(s.log, current, retired, keyID2, key2.Public())
+	retiredJSON, err := json.Marshal(retired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.patchJWKS(context.Background(), s.log, &secret, jwks, retiredJSON, keyID2, key2.Public()); err != nil {
+		t.Fatal(err)
+	}
+
+	if patches != 2 {
+		t.Errorf("expected conflict to be retried once, got %d patches", patches)
+	}
+
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	got, retired, err := jwksFromSecret(s.log, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, keyID := range []string{keyID1, keyID2, concurrentKeyID} {
+		if !got.HasJWTAuthority(keyID) {
+			t.Errorf("expected key %s in JWKS", keyID)
+		}
+	}
+	for _, keyID := range []string{keyID1, concurrentKeyID} {
+		if _, ok := retired[keyID]; !ok {
+			t.Errorf("expected key %s to be retired", keyID)
+		}
+	}
+}
+
+func Test_reconcileJWT_sentryJWT(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := (&jose.JSONWebKey{Key: key.Public()}).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		fixedKeyID string
+		expKeyID   string
+	}{
+		"JWTs signed with the JWK thumbprint key ID should verify": {
+			expKeyID: base64.RawURLEncoding.EncodeToString(thumbprint),
+		},
+		"JWTs signed with a fixed key ID should verify": {
+			fixedKeyID: "dapr-sentry",
+			expKeyID:   "dapr-sentry",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, _ := newTestSecretCtrl(t, time.Now(),
+				&cmapi.Certificate{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-jwt"},
+					Spec:       cmapi.CertificateSpec{SecretName: "dapr-jwt"},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-jwt"},
+					Data:       map[string][]byte{"tls.key": keyPEM(t, key)},
+				},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"}},
+			)
+			s.jwtCertName = "dapr-jwt"
+			s.jwtFixedKeyID = test.fixedKeyID
+
+			if _, err := s.reconcileJWT(context.Background(), s.log, "dapr-system"); err != nil {
+				t.Fatal(err)
+			}
+
+			var secret corev1.Secret
+			if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+				t.Fatal(err)
+			}
+
+			// Sign a JWT with the written signing key as dapr Sentry does, with
+			// the key ID in the header.
+			signingKey, err := parseSigningKey(secret.Data["jwt.key"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			signer, err := jose.NewSigner(jose.SigningKey{
+				Algorithm: jose.ES256,
+				Key:       jose.JSONWebKey{Key: signingKey, KeyID: test.expKeyID},
+			}, new(jose.SignerOptions).WithType("JWT"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := josejwt.Signed(signer).Claims(josejwt.Claims{
+				Subject:  "spiffe://public/ns/default/app",
+				Audience: josejwt.Audience{"public"},
+				Expiry:   josejwt.NewNumericDate(time.Now().Add(time.Hour)),
+			}).Serialize()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trustDomain := spiffeid.RequireTrustDomainFromString("public")
+			jwks, err := jwtbundle.Parse(trustDomain, secret.Data["jwks.json"])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := jwtsvid.ParseAndValidate(token, jwks, []string{"public"}); err != nil {
+				t.Errorf("expected JWT to verify against the JWKS: %s", err)
+			}
+		})
+	}
+}
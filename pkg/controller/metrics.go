@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// trustAnchorsPrunedTotal counts the expired trust anchors which have been
+	// pruned from a dapr trust-bundle Secret.
+	trustAnchorsPrunedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "trust_anchors_pruned_total",
+		Help:      "Number of expired trust anchors pruned from the dapr trust-bundle Secret.",
+	}, []string{"namespace", "secret"})
+
+	// issuerNotAfter is the NotAfter time of the issuer certificate in a dapr
+	// Secret.
+	issuerNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "issuer_not_after_seconds",
+		Help:      "The NotAfter time of the issuer certificate in the dapr Secret, in seconds since the Unix epoch.",
+	}, []string{"namespace", "secret"})
+
+	// issuerNotBefore is the NotBefore time of the issuer certificate in a dapr
+	// Secret.
+	issuerNotBefore = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "issuer_not_before_seconds",
+		Help:      "The NotBefore time of the issuer certificate in the dapr Secret, in seconds since the Unix epoch.",
+	}, []string{"namespace", "secret"})
+
+	// trustAnchorNotAfter is the NotAfter time of each trust anchor in a dapr
+	// trust-bundle Secret.
+	trustAnchorNotAfter = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "trust_anchor_not_after_seconds",
+		Help:      "The NotAfter time of a trust anchor in the dapr trust-bundle Secret, in seconds since the Unix epoch.",
+	}, []string{"namespace", "secret", "subject", "fingerprint"})
+
+	// trustAnchors is the number of trust anchors in a dapr trust-bundle
+	// Secret.
+	trustAnchors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "trust_anchors",
+		Help:      "Number of trust anchors in the dapr trust-bundle Secret.",
+	}, []string{"namespace", "secret"})
+
+	// lastSyncTimestamp is the time of the last successful sync of a dapr
+	// Secret.
+	lastSyncTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "The time of the last successful sync of the dapr Secret, in seconds since the Unix epoch.",
+	}, []string{"namespace", "secret"})
+
+	// updatesTotal counts the updates written to a dapr Secret.
+	updatesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "updates_total",
+		Help:      "Number of updates written to the dapr Secret.",
+	}, []string{"namespace", "secret"})
+
+	// validationRejectionsTotal counts the issuers from cert-manager which have
+	// been rejected by validation.
+	validationRejectionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "validation_rejections_total",
+		Help:      "Number of issuer updates to the dapr Secret rejected by validation.",
+	}, []string{"namespace", "secret"})
+
+	// writeStepsTotal counts the steps of writing to the dapr Secrets by their
+	// result.
+	writeStepsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "write_steps_total",
+		Help:      "Number of steps of writing to the dapr Secret, by step and result.",
+	}, []string{"namespace", "secret", "step", "result"})
+
+	// webhookDecisionsTotal counts the decisions of the validating webhook on
+	// edits of a dapr trust-bundle Secret by other principals.
+	webhookDecisionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "webhook_decisions_total",
+		Help:      "Number of edits of the dapr trust-bundle Secret by other principals, by webhook decision.",
+	}, []string{"namespace", "secret", "decision"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		trustAnchorsPrunedTotal,
+		issuerNotAfter,
+		issuerNotBefore,
+		trustAnchorNotAfter,
+		trustAnchors,
+		lastSyncTimestamp,
+		updatesTotal,
+		validationRejectionsTotal,
+		writeStepsTotal,
+		webhookDecisionsTotal,
+	)
+}
+
+// observeSync records the issuer and trust anchor metrics of the given data,
+// which has been successfully synced to the dapr Secrets of the secretConf.
+func observeSync(clock clock.PassiveClock, namespace string, conf secretConf, issuerPEM, caPEM []byte) {
+	if chain, err := parseCertificates(issuerPEM); err == nil {
+		issuerNotAfter.WithLabelValues(namespace, conf.certSecretName).Set(float64(chain[0].NotAfter.Unix()))
+		issuerNotBefore.WithLabelValues(namespace, conf.certSecretName).Set(float64(chain[0].NotBefore.Unix()))
+	}
+
+	if len(conf.caSecretName) > 0 {
+		// Remove trust anchors which are no longer in the bundle.
+		trustAnchorNotAfter.DeletePartialMatch(prometheus.Labels{"namespace": namespace, "secret": conf.caSecretName})
+
+		var count int
+		if bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, caPEM); err == nil {
+			for _, anchor := range bundle.X509Authorities() {
+				trustAnchorNotAfter.WithLabelValues(namespace, conf.caSecretName, anchor.Subject.String(), fingerprint(anchor)).Set(float64(anchor.NotAfter.Unix()))
+			}
+			count = len(bundle.X509Authorities())
+		}
+		trustAnchors.WithLabelValues(namespace, conf.caSecretName).Set(float64(count))
+	}
+
+	lastSyncTimestamp.WithLabelValues(namespace, conf.certSecretName).Set(float64(clock.Now().Unix()))
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+func Test_observeSync(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	root1 := genCA(t, "root-1", nil, now.Add(-time.Hour), now.Add(time.Hour*2))
+	root2 := genCA(t, "root-2", nil, now.Add(-time.Hour), now.Add(time.Hour*3))
+	issuer := genCA(t, "issuer", root1, now.Add(-time.Minute), now.Add(time.Hour))
+
+	conf := testSecretConf
+	conf.certSecretName = "observe-sync"
+	conf.caSecretName = "observe-sync"
+	clock := clocktesting.NewFakePassiveClock(now)
+
+	observeSync(clock, "dapr-system", conf, certPEM(issuer.cert), certPEM(root1.cert, root2.cert))
+
+	if v := testutil.ToFloat64(issuerNotAfter.WithLabelValues("dapr-system", "observe-sync")); v != float64(issuer.cert.NotAfter.Unix()) {
+		t.Errorf("unexpected issuer not after, exp=%d got=%v", issuer.cert.NotAfter.Unix(), v)
+	}
+	if v := testutil.ToFloat64(issuerNotBefore.WithLabelValues("dapr-system", "observe-sync")); v != float64(issuer.cert.NotBefore.Unix()) {
+		t.Errorf("unexpected issuer not before, exp=%d got=%v", issuer.cert.NotBefore.Unix(), v)
+	}
+	if v := testutil.ToFloat64(trustAnchors.WithLabelValues("dapr-system", "observe-sync")); v != 2 {
+		t.Errorf("unexpected trust anchor count, exp=2 got=%v", v)
+	}
+	if v := testutil.ToFloat64(lastSyncTimestamp.WithLabelValues("dapr-system", "observe-sync")); v != float64(now.Unix()) {
+		t.Errorf("unexpected last sync timestamp, exp=%d got=%v", now.Unix(), v)
+	}
+
+	// Trust anchors removed from the bundle should no longer be reported.
+	observeSync(clock, "dapr-system", conf, certPEM(issuer.cert), certPEM(root1.cert))
+
+	if v := testutil.ToFloat64(trustAnchors.WithLabelValues("dapr-system", "observe-sync")); v != 1 {
+		t.Errorf("unexpected trust anchor count, exp=1 got=%v", v)
+	}
+	if v := testutil.ToFloat64(trustAnchorNotAfter.WithLabelValues("dapr-system", "observe-sync", root1.cert.Subject.String(), fingerprint(root1.cert))); v != float64(root1.cert.NotAfter.Unix()) {
+		t.Errorf("unexpected trust anchor not after, exp=%d got=%v", root1.cert.NotAfter.Unix(), v)
+	}
+	if trustAnchorNotAfter.DeleteLabelValues("dapr-system", "observe-sync", root2.cert.Subject.String(), fingerprint(root2.cert)) {
+		t.Error("expected removed trust anchor to no longer be reported")
+	}
+}
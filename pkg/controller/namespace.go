@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+// managesNamespace returns true if the given namespace is a dapr namespace
+// managed by this controller, either because it is explicitly listed or
+// because it matches the namespace selector.
+func (s *secretCtrl) managesNamespace(ctx context.Context, namespace string) bool {
+	if _, ok := s.daprNamespaces[namespace]; ok {
+		return true
+	}
+
+	if s.namespaceSelector == nil {
+		return false
+	}
+
+	var ns corev1.Namespace
+	err := s.lister.Get(ctx, types.NamespacedName{Name: namespace}, &ns)
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	if err != nil {
+		s.log.Error(err, "failed to get Namespace", "namespace", namespace)
+		return false
+	}
+
+	return s.namespaceSelector.Matches(labels.Set(ns.Labels))
+}
+
+// managedNamespaces returns all dapr namespaces managed by this controller.
+func (s *secretCtrl) managedNamespaces(ctx context.Context) ([]string, error) {
+	namespaces := make([]string, 0, len(s.daprNamespaces))
+	for namespace := range s.daprNamespaces {
+		namespaces = append(namespaces, namespace)
+	}
+
+	if s.namespaceSelector == nil {
+		return namespaces, nil
+	}
+
+	var nsList corev1.NamespaceList
+	if err := s.lister.List(ctx, &nsList); err != nil {
+		return nil, err
+	}
+	for _, ns := range nsList.Items {
+		if _, ok := s.daprNamespaces[ns.Name]; ok {
+			continue
+		}
+		if s.namespaceSelector.Matches(labels.Set(ns.Labels)) {
+			namespaces = append(namespaces, ns.Name)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// trustAnchorFor returns the trust anchor source for the given dapr
+// namespace. Returns nil if the `ca.crt` of the cert-manager Secret should be
+// used.
+func (s *secretCtrl) trustAnchorFor(namespace string) x509bundle.Source {
+	if ta, ok := s.namespaceTrustAnchors[namespace]; ok {
+		return ta
+	}
+	return s.trustAnchor
+}
+
+// trustAnchorRequests returns a reconcile request for every dapr namespace
+// which uses the default trust anchor source.
+func (s *secretCtrl) trustAnchorRequests(ctx context.Context) []ctrl.Request {
+	namespaces, err := s.managedNamespaces(ctx)
+	if err != nil {
+		s.log.Error(err, "failed to list managed dapr namespaces")
+		return nil
+	}
+
+	var reqs []ctrl.Request
+	for _, namespace := range namespaces {
+		if _, ok := s.namespaceTrustAnchors[namespace]; ok {
+			continue
+		}
+		reqs = append(reqs, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "dapr-trust-bundle"}})
+	}
+
+	return reqs
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_managesNamespace(t *testing.T) {
+	selector, err := labels.Parse("dapr.io/control-plane=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lister := fake.NewClientBuilder().WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-a", Labels: map[string]string{"dapr.io/control-plane": "true"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "tenant-b", Labels: map[string]string{"dapr.io/control-plane": "false"}}},
+	).Build()
+
+	tests := map[string]struct {
+		selector  labels.Selector
+		namespace string
+		exp       bool
+	}{
+		"listed namespace should be managed": {
+			namespace: "dapr-system",
+			exp:       true,
+		},
+		"unlisted namespace without selector should not be managed": {
+			namespace: "tenant-a",
+			exp:       false,
+		},
+		"namespace matching selector should be managed": {
+			selector:  selector,
+			namespace: "tenant-a",
+			exp:       true,
+		},
+		"namespace not matching selector should not be managed": {
+			selector:  selector,
+			namespace: "tenant-b",
+			exp:       false,
+		},
+		"namespace which does not exist should not be managed": {
+			selector:  selector,
+			namespace: "tenant-c",
+			exp:       false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s := &secretCtrl{
+				log:               klogr.New(),
+				lister:            lister,
+				daprNamespaces:    map[string]struct{}{"dapr-system": {}},
+				namespaceSelector: test.selector,
+			}
+			if got := s.managesNamespace(context.Background(), test.namespace); got != test.exp {
+				t.Errorf("unexpected managesNamespace result, exp=%t got=%t", test.exp, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// fieldManager is the field manager of all writes made to dapr Secrets.
+	fieldManager = "dapr-cert-manager"
+)
+
+// Steps of writing to the dapr Secrets, in the order they are made.
+const (
+	writeStepTrustAnchors   = "trust_anchors"
+	writeStepVerify         = "verify"
+	writeStepIssuer         = "issuer"
+	writeStepRotationStatus = "rotation_status"
+)
+
+// observeWriteStep records the result of a step of writing to the dapr
+// Secrets. A failed step is logged and recorded as an Event on the given
+// objects, since all later steps are skipped. Returns the given error.
+func (s *secretCtrl) observeWriteStep(log logr.Logger, namespace, secret, step string, err error, objs ...runtime.Object) error {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	writeStepsTotal.WithLabelValues(namespace, secret, step, result).Inc()
+
+	if err != nil {
+		log.Error(err, "failed to write dapr Secret, skipping later steps", "step", step, "secret", secret)
+		s.recordEvent(corev1.EventTypeWarning, reasonWriteFailed,
+			fmt.Sprintf("Failed step %q writing dapr Secret %q, later steps were skipped: %s", step, secret, err), objs...)
+	}
+
+	return err
+}
+
+// patchSecretData patches only the given keys of the Secret's data, leaving
+// all other keys untouched so that keys written by other writers of the Secret
+// are never clobbered. The keys are owned by dapr-cert-manager, so the patch
+// is not conditional on the resourceVersion. Returns false if the Secret
+// already contained the given data and no patch was made.
+func (s *secretCtrl) patchSecretData(ctx context.Context, secret *corev1.Secret, data map[string][]byte) (bool, error) {
+	orig := secret.DeepCopy()
+
+	var changed bool
+	for key, value := range data {
+		if !bytes.Equal(secret.Data[key], value) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	for key, value := range data {
+		secret.Data[key] = value
+	}
+
+	return true, s.client.Patch(ctx, secret, client.MergeFrom(orig), client.FieldOwner(fieldManager))
+}
+
+// patchTrustAnchors patches the trust bundle key of the dapr CA Secret with
+// the given trust bundle. The patch is conditional on the resourceVersion of
+// the Secret so that trust anchors written concurrently are never lost. On
+// conflict, the latest Secret is read and the trust anchors added and pruned
+// by the update are re-applied to its trust bundle, up to a bounded number of
+// retries. Returns the trust bundle written.
+func (s *secretCtrl) patchTrustAnchors(ctx context.Context, conf secretConf, secret *corev1.Secret, update *bundleUpdate) ([]byte, error) {
+	bundle := update.trustAnchors
+
+	var taPEM []byte
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var err error
+		taPEM, err = bundle.Marshal()
+		if err != nil {
+			// This error should never really happen since we just parsed the certs.
+			// We are extra noisy here so its easier to pick up by the user and
+			// report the bug.
+			s.log.Error(err, "failed to marshal trust anchor, this error is a bug, please report the issue to Diagrid")
+			return fmt.Errorf("this error is a bug, please report this issue to Diagrid: %w", err)
+		}
+
+		orig := secret.DeepCopy()
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[conf.certSecretCAKey] = taPEM
+
+		patchErr := s.client.Patch(ctx, secret, client.MergeFromWithOptions(orig, client.MergeFromWithOptimisticLock{}), client.FieldOwner(fieldManager))
+		if !apierrors.IsConflict(patchErr) {
+			return patchErr
+		}
+
+		// Re-apply the update to the latest trust bundle before retrying.
+		var latest corev1.Secret
+		if err := s.apiReader.Get(ctx, client.ObjectKeyFromObject(secret), &latest); err != nil {
+			return err
+		}
+		*secret = latest
+		bundle, err = latestTrustAnchors(conf, latest, update)
+		if err != nil {
+			return err
+		}
+
+		return patchErr
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return taPEM, nil
+}
+
+// patchRotationStatus patches the root CA rotation status annotation of the
+// dapr CA Secret.
+func (s *secretCtrl) patchRotationStatus(ctx context.Context, secret *corev1.Secret, status *rotationStatus) error {
+	value, err := marshalRotationStatus(status)
+	if err != nil {
+		return err
+	}
+
+	orig := secret.DeepCopy()
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annotationRootRotation] = value
+
+	return s.client.Patch(ctx, secret, client.MergeFrom(orig), client.FieldOwner(fieldManager))
+}
+
+// verifyTrustAnchors reads back the dapr CA Secret with the given key, and
+// verifies that its trust bundle contains the trust anchors added by the
+// update, and that the given issuer chains to one of its trust anchors.
+func (s *secretCtrl) verifyTrustAnchors(ctx context.Context, conf secretConf, key client.ObjectKey, update *bundleUpdate, issuerPEM []byte) error {
+	var secret corev1.Secret
+	if err := s.apiReader.Get(ctx, key, &secret); err != nil {
+		return fmt.Errorf("failed to read back dapr CA Secret: %w", err)
+	}
+
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data[conf.certSecretCAKey])
+	if err != nil {
+		return fmt.Errorf("failed to parse trust anchor from dapr CA Secret: %w", err)
+	}
+
+	for _, cert := range update.added {
+		if !bundle.HasX509Authority(cert) {
+			return fmt.Errorf("trust anchor sha256=%s is missing from dapr CA Secret", fingerprint(cert))
+		}
+	}
+
+	chain, err := parseCertificates(issuerPEM)
+	if err != nil {
+		return fmt.Errorf("failed to parse issuer certificate: %w", err)
+	}
+	if issuerRoot(chain, bundle) == nil {
+		return errors.New("issuer certificate does not chain to any trust anchor in dapr CA Secret")
+	}
+
+	return nil
+}
+
+// latestTrustAnchors returns the trust bundle of the given dapr CA Secret, with
+// the trust anchors added and removed by the update applied. If the update is
+// authoritative, the trust bundle of the update is returned unchanged.
+func latestTrustAnchors(conf secretConf, secret corev1.Secret, update *bundleUpdate) (*x509bundle.Bundle, error) {
+	if update.authoritative {
+		return update.trustAnchors, nil
+	}
+
+	bundle := x509bundle.New(spiffeid.TrustDomain{})
+	if len(secret.Data[conf.certSecretCAKey]) > 0 {
+		var err error
+		bundle, err = x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data[conf.certSecretCAKey])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trust anchor from dapr certificate Secret: %w", err)
+		}
+	}
+
+	for _, cert := range update.added {
+		if !bundle.HasX509Authority(cert) {
+			bundle.AddX509Authority(cert)
+		}
+	}
+	for _, cert := range slices.Concat(update.pruned, update.removed) {
+		bundle.RemoveX509Authority(cert)
+	}
+
+	return bundle, nil
+}
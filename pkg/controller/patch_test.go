@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func Test_patchSecretData(t *testing.T) {
+	s, _ := newTestSecretCtrl(t, time.Now(), &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data: map[string][]byte{
+			"issuer.crt": []byte("old-cert"),
+			"other":      []byte("other"),
+		},
+	})
+
+	var secret corev1.Secret
+	if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer adds a key after the Secret was read.
+	concurrent := secret.DeepCopy()
+	concurrent.Data["concurrent"] = []byte("concurrent")
+	if err := s.client.Update(context.Background(), concurrent); err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := s.patchSecretData(context.Background(), &secret, map[string][]byte{"issuer.crt": []byte("new-cert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !patched {
+		t.Error("expected Secret to be patched")
+	}
+
+	if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	for key, exp := range map[string]string{"issuer.crt": "new-cert", "other": "other", "concurrent": "concurrent"} {
+		if string(secret.Data[key]) != exp {
+			t.Errorf("unexpected value of key %q, exp=%q got=%q", key, exp, secret.Data[key])
+		}
+	}
+
+	patched, err = s.patchSecretData(context.Background(), &secret, map[string][]byte{"issuer.crt": []byte("new-cert")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched {
+		t.Error("expected Secret with same data to not be patched")
+	}
+}
+
+func Test_patchTrustAnchors(t *testing.T) {
+	now := time.Now()
+	oldRoot := genCA(t, "old-root", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	concurrentRoot := genCA(t, "concurrent-root", nil, now.Add(-time.Hour), now.Add(time.Hour))
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	var patches int
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data:       map[string][]byte{"ca.crt": certPEM(oldRoot.cert)},
+	}).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patches++
+			if patches == 1 {
+				// Another writer adds a trust anchor before the first patch.
+				var secret corev1.Secret
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(obj), &secret); err != nil {
+					return err
+				}
+				secret.Data["ca.crt"] = certPEM(oldRoot.cert, concurrentRoot.cert)
+				if err := cl.Update(ctx, &secret); err != nil {
+					return err
+				}
+			}
+			return cl.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+
+	s := &secretCtrl{log: klogr.New(), apiReader: cl, secretReader: cl, client: cl}
+
+	var secret corev1.Secret
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+
+	update := &bundleUpdate{
+		trustAnchors: x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{oldRoot.cert, root.cert}),
+		added:        []*x509.Certificate{root.cert},
+	}
+	if _, err := s.patchTrustAnchors(context.Background(), testSecretConf, &secret, update); err != nil {
+		t.Fatal(err)
+	}
+
+	if patches != 2 {
+		t.Errorf("expected conflict to be retried once, got %d patches", patches)
+	}
+
+	if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, secret.Data["ca.crt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bundle.Equal(x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{oldRoot.cert, concurrentRoot.cert, root.cert})) {
+		t.Errorf("expected concurrently added trust anchor to be preserved, got %d trust anchors", len(bundle.X509Authorities()))
+	}
+}
+
+func Test_reconcileBundle_writeOrder(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	conf := secretConf{
+		certName:        "dapr-trust-bundle",
+		certSecretName:  "dapr-issuer",
+		caSecretName:    "dapr-ca",
+		certSectretKey:  "issuer.crt",
+		certSecretPKKey: "issuer.key",
+		certSecretCAKey: "ca.crt",
+	}
+
+	tests := map[string]struct {
+		failStep   string
+		expPatches []string
+		expIssuer  bool
+	}{
+		"trust anchors should be written and verified before the issuer": {
+			expPatches: []string{"dapr-ca", "dapr-issuer"},
+			expIssuer:  true,
+		},
+		"failing to write trust anchors should not write the issuer": {
+			failStep:   writeStepTrustAnchors,
+			expPatches: []string{"dapr-ca"},
+		},
+		"failing to read back trust anchors should not write the issuer": {
+			failStep:   writeStepVerify,
+			expPatches: []string{"dapr-ca"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, recorder := newTestSecretCtrl(t, now)
+
+			var patches []string
+			cl := fake.NewClientBuilder().WithScheme(s.client.Scheme()).WithObjects(append(testObjects(t, issuer, root, nil)[:2],
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-issuer"}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-ca"}},
+			)...).WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, cl client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if test.failStep == writeStepVerify && key.Name == "dapr-ca" && len(patches) > 0 {
+						return errors.New("read back failed")
+					}
+					return cl.Get(ctx, key, obj, opts...)
+				},
+				Patch: func(ctx context.Context, cl client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					patches = append(patches, obj.GetName())
+					if test.failStep == writeStepTrustAnchors && obj.GetName() == "dapr-ca" {
+						return errors.New("patch failed")
+					}
+					return cl.Patch(ctx, obj, patch, opts...)
+				},
+			}).Build()
+			s.lister, s.apiReader, s.secretReader, s.client = cl, cl, cl, cl
+
+			_, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", conf, defaultDaprSystemConfig())
+			if (err != nil) != (len(test.failStep) > 0) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(patches, test.expPatches) {
+				t.Errorf("unexpected patches, exp=%v got=%v", test.expPatches, patches)
+			}
+
+			var secret corev1.Secret
+			if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-issuer"}, &secret); err != nil {
+				t.Fatal(err)
+			}
+			if written := len(secret.Data["issuer.crt"]) > 0; written != test.expIssuer {
+				t.Errorf("expected issuer written=%t, got %t", test.expIssuer, written)
+			}
+
+			events := strings.Join(drainEvents(recorder), "\n")
+			if failed := strings.Contains(events, reasonWriteFailed); failed != (len(test.failStep) > 0) {
+				t.Errorf("unexpected %s event, got %q", reasonWriteFailed, events)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Plan is a pending change to the dapr Secrets of a single dapr certificate
+// configuration. Certificates are summarised, and never contain PEM data.
+type Plan struct {
+	// Namespace is the dapr namespace of the Secrets.
+	Namespace string `json:"namespace"`
+
+	// CertificateName is the name of the source cert-manager Certificate.
+	CertificateName string `json:"certificateName"`
+
+	// SecretName is the name of the dapr Secret containing the issuer.
+	SecretName string `json:"secretName"`
+
+	// CASecretName is the name of the dapr Secret containing the trust bundle.
+	CASecretName string `json:"caSecretName,omitempty"`
+
+	// Pending is true if the dapr Secrets would be updated.
+	Pending bool `json:"pending"`
+
+	// Issuer is the change of the issuer certificate. Nil if the issuer
+	// certificate is unchanged.
+	Issuer *IssuerChange `json:"issuer,omitempty"`
+
+	// TrustAnchorsAdded are the trust anchors which would be added to the trust
+	// bundle.
+	TrustAnchorsAdded []CertificateSummary `json:"trustAnchorsAdded,omitempty"`
+
+	// TrustAnchorsRemoved are the trust anchors which would be removed from the
+	// trust bundle.
+	TrustAnchorsRemoved []CertificateSummary `json:"trustAnchorsRemoved,omitempty"`
+
+	// IssuerHeld is true if the new issuer certificate is being held back
+	// until its root CA has been distributed for the root rotation soak
+	// period.
+	IssuerHeld bool `json:"issuerHeld,omitempty"`
+
+	// RotationPhase is the phase a root CA rotation would enter. Empty if the
+	// phase is unchanged.
+	RotationPhase string `json:"rotationPhase,omitempty"`
+
+	// Error is the reason the dapr Secrets would not be updated, for example
+	// because the issuer failed validation.
+	Error string `json:"error,omitempty"`
+}
+
+// IssuerChange is the change of an issuer certificate.
+type IssuerChange struct {
+	// From is the current issuer certificate. Nil if there is no valid current
+	// issuer.
+	From *CertificateSummary `json:"from,omitempty"`
+
+	// To is the new issuer certificate.
+	To CertificateSummary `json:"to"`
+}
+
+// CertificateSummary identifies a certificate.
+type CertificateSummary struct {
+	Subject     string    `json:"subject"`
+	Serial      string    `json:"serial"`
+	Fingerprint string    `json:"fingerprint"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// PlanOptions configure PlanTrustBundle.
+type PlanOptions struct {
+	Options
+
+	// TrustAnchor is used for the trust-bundle trust anchors in place of
+	// Options.TrustAnchor, which must be running to be used. If nil, the
+	// `ca.crt` created by cert-manager will be used.
+	TrustAnchor x509bundle.Source
+
+	// NamespaceTrustAnchors optionally override TrustAnchor for the dapr
+	// namespace of the map key, in place of Options.NamespaceTrustAnchors.
+	NamespaceTrustAnchors map[string]x509bundle.Source
+}
+
+// PlanTrustBundle returns the changes which the trust-bundle controller would make to
+// every dapr Secret it manages, without writing them. The given reader is used
+// to read all resources.
+func PlanTrustBundle(ctx context.Context, reader client.Reader, opts PlanOptions) ([]Plan, error) {
+	secCtl, err := newSecretCtrl(opts.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	secCtl.lister = reader
+	secCtl.apiReader = reader
+	secCtl.secretReader = reader
+	secCtl.daprConfigReader = reader
+	secCtl.trustAnchor = opts.TrustAnchor
+	secCtl.namespaceTrustAnchors = make(map[string]x509bundle.Source)
+	for namespace, ta := range opts.NamespaceTrustAnchors {
+		secCtl.namespaceTrustAnchors[namespace] = ta
+	}
+	secCtl.dryRun = true
+	secCtl.plans = []Plan{}
+
+	namespaces, err := secCtl.managedNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed dapr namespaces: %w", err)
+	}
+
+	var plans []Plan
+	for _, namespace := range namespaces {
+		confs, err := secCtl.secretConfs(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		daprConf, err := getDaprSystemConfig(ctx, reader, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, conf := range confs {
+			secCtl.plans = secCtl.plans[:0]
+			_, err := secCtl.reconcileBundle(ctx, secCtl.log, namespace, conf, daprConf)
+			if len(secCtl.plans) > 0 {
+				plans = append(plans, secCtl.plans...)
+				continue
+			}
+
+			plan := newPlan(namespace, conf, nil)
+			if err != nil {
+				plan.Error = err.Error()
+			}
+			plans = append(plans, plan)
+		}
+	}
+
+	return plans, nil
+}
+
+// newPlan returns the Plan of the given bundleUpdate. The Plan is not pending
+// if the update is nil.
+func newPlan(namespace string, conf secretConf, update *bundleUpdate) Plan {
+	plan := Plan{
+		Namespace:       namespace,
+		CertificateName: conf.certName,
+		SecretName:      conf.certSecretName,
+		CASecretName:    conf.caSecretName,
+	}
+	if update == nil {
+		return plan
+	}
+
+	plan.Pending = true
+	plan.IssuerHeld = update.holdIssuer
+	if update.rotation != nil {
+		plan.RotationPhase = string(update.rotation.Phase)
+	}
+	if update.issuer != nil {
+		plan.Issuer = &IssuerChange{To: summarizeCertificate(update.issuer)}
+		if update.previousIssuer != nil {
+			from := summarizeCertificate(update.previousIssuer)
+			plan.Issuer.From = &from
+		}
+	}
+	for _, cert := range update.added {
+		plan.TrustAnchorsAdded = append(plan.TrustAnchorsAdded, summarizeCertificate(cert))
+	}
+	for _, cert := range slices.Concat(update.pruned, update.removed) {
+		plan.TrustAnchorsRemoved = append(plan.TrustAnchorsRemoved, summarizeCertificate(cert))
+	}
+
+	return plan
+}
+
+// summarizeCertificate returns the CertificateSummary of the given
+// certificate.
+func summarizeCertificate(cert *x509.Certificate) CertificateSummary {
+	return CertificateSummary{
+		Subject:     cert.Subject.String(),
+		Serial:      cert.SerialNumber.String(),
+		Fingerprint: fingerprint(cert),
+		NotAfter:    cert.NotAfter.UTC(),
+	}
+}
+
+// reportPlan logs the given pending Plan in place of writing it, and collects
+// it if the controller is collecting plans.
+func (s *secretCtrl) reportPlan(log logr.Logger, plan Plan) {
+	values := []any{"secret", plan.SecretName, "ca_secret", plan.CASecretName}
+	if plan.Issuer != nil {
+		from := "none"
+		if plan.Issuer.From != nil {
+			from = plan.Issuer.From.Serial
+		}
+		values = append(values, "issuer_serial_from", from, "issuer_serial_to", plan.Issuer.To.Serial)
+	}
+	for _, key := range []struct {
+		name  string
+		certs []CertificateSummary
+	}{
+		{"trust_anchors_added", plan.TrustAnchorsAdded},
+		{"trust_anchors_removed", plan.TrustAnchorsRemoved},
+	} {
+		if len(key.certs) == 0 {
+			continue
+		}
+		fingerprints := make([]string, len(key.certs))
+		for i, cert := range key.certs {
+			fingerprints[i] = cert.Fingerprint
+		}
+		values = append(values, key.name, fingerprints)
+	}
+
+	log.Info("dry-run: not updating dapr certificate Secret", values...)
+
+	s.planLock.Lock()
+	defer s.planLock.Unlock()
+	if s.plans != nil {
+		s.plans = append(s.plans, plan)
+	}
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func Test_PlanTrustBundle(t *testing.T) {
+	now := time.Now()
+	oldRoot := genCA(t, "old-root", nil, now.Add(-time.Hour*48), now.Add(time.Hour*48))
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	oldIssuer := genCA(t, "old-issuer", oldRoot, now.Add(-time.Hour*48), now.Add(time.Hour*47))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	expiredIssuer := genCA(t, "expired-issuer", root, now.Add(-time.Hour*2), now.Add(-time.Hour))
+
+	opts := PlanOptions{Options: Options{
+		Log:                        klogr.New(),
+		DaprNamespaces:             []string{"dapr-system"},
+		TrustBundleCertificateName: "dapr-trust-bundle",
+	}}
+
+	tests := map[string]struct {
+		issuer   *testCA
+		daprData map[string][]byte
+		expPlan  func(t *testing.T, plan Plan)
+	}{
+		"pending issuer rotation and added trust anchor should be planned": {
+			issuer: issuer,
+			daprData: map[string][]byte{
+				"issuer.crt": certPEM(oldIssuer.cert),
+				"issuer.key": keyPEM(t, oldIssuer.key),
+				"ca.crt":     certPEM(oldRoot.cert),
+			},
+			expPlan: func(t *testing.T, plan Plan) {
+				if !plan.Pending {
+					t.Error("expected plan to be pending")
+				}
+				if plan.Issuer == nil || plan.Issuer.From == nil {
+					t.Fatal("expected issuer change from the old issuer")
+				}
+				if plan.Issuer.From.Serial != oldIssuer.cert.SerialNumber.String() || plan.Issuer.To.Serial != issuer.cert.SerialNumber.String() {
+					t.Errorf("unexpected issuer change %s -> %s", plan.Issuer.From.Serial, plan.Issuer.To.Serial)
+				}
+				if len(plan.TrustAnchorsAdded) != 1 || plan.TrustAnchorsAdded[0].Fingerprint != fingerprint(root.cert) {
+					t.Errorf("expected new root to be added, got %v", plan.TrustAnchorsAdded)
+				}
+				if len(plan.TrustAnchorsRemoved) != 0 {
+					t.Errorf("expected no trust anchors to be removed, got %v", plan.TrustAnchorsRemoved)
+				}
+			},
+		},
+		"up to date dapr Secret should plan no changes": {
+			issuer: issuer,
+			daprData: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(root.cert),
+			},
+			expPlan: func(t *testing.T, plan Plan) {
+				if plan.Pending || plan.Issuer != nil || len(plan.TrustAnchorsAdded) > 0 || len(plan.Error) > 0 {
+					t.Errorf("expected no changes, got %+v", plan)
+				}
+			},
+		},
+		"invalid issuer should plan an error": {
+			issuer:   expiredIssuer,
+			daprData: nil,
+			expPlan: func(t *testing.T, plan Plan) {
+				if plan.Pending {
+					t.Error("expected plan to not be pending")
+				}
+				if len(plan.Error) == 0 {
+					t.Error("expected plan error")
+				}
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			if err := corev1.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			if err := cmapi.AddToScheme(scheme); err != nil {
+				t.Fatal(err)
+			}
+			cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(testObjects(t, test.issuer, root, test.daprData)...).Build()
+
+			plans, err := PlanTrustBundle(context.Background(), cl, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(plans) != 1 {
+				t.Fatalf("expected 1 plan, got %d", len(plans))
+			}
+			test.expPlan(t, plans[0])
+
+			var secret corev1.Secret
+			if err := cl.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range test.daprData {
+				if string(secret.Data[key]) != string(value) {
+					t.Errorf("expected dapr Secret key %q to not be updated", key)
+				}
+			}
+			if len(secret.Data) != len(test.daprData) {
+				t.Errorf("expected dapr Secret to not be updated")
+			}
+		})
+	}
+}
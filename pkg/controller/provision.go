@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// labelProvisioned is the label of the cert-manager Certificates which
+	// are provisioned, and owned, by dapr-cert-manager. Certificates without
+	// the label are never modified.
+	labelProvisioned = "dapr-cert-manager.diagrid.io/provisioned"
+)
+
+// ProvisionOptions configure the provisioning of the trust-bundle cert-manager
+// Certificate, when it does not exist.
+type ProvisionOptions struct {
+	// Enabled creates the trust-bundle cert-manager Certificate in each dapr
+	// namespace if it does not exist, and keeps the Certificates it created
+	// up to date with the options.
+	Enabled bool
+
+	// IssuerRef is the cert-manager issuer which signs the dapr issuer
+	// certificate, typically a CA Issuer of the root CA.
+	IssuerRef cmmeta.ObjectReference
+
+	// Duration and RenewBefore are the requested lifetime of the dapr issuer
+	// certificate, and how long before expiry it is renewed. RenewBefore must
+	// be longer than the dapr workload certificate TTL.
+	Duration    time.Duration
+	RenewBefore time.Duration
+
+	// PrivateKeyAlgorithm and PrivateKeySize are the key of the dapr issuer
+	// certificate. Must be supported by dapr Sentry.
+	PrivateKeyAlgorithm cmapi.PrivateKeyAlgorithm
+	PrivateKeySize      int
+}
+
+// provisionedCertificate returns the cert-manager Certificate of the dapr
+// issuer provisioned for the secretConf in the given namespace. The
+// Certificate is a CA which may only sign certificates, rotating its private
+// key on every issuance.
+func (s *secretCtrl) provisionedCertificate(namespace string, conf secretConf, daprConf daprSystemConfig) *cmapi.Certificate {
+	return &cmapi.Certificate{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      conf.certName,
+			Labels:    map[string]string{labelProvisioned: "true"},
+		},
+		Spec: cmapi.CertificateSpec{
+			SecretName: provisionedSecretName(conf.certName),
+			CommonName: "dapr-sentry-issuer-from-cert-manager",
+			// The control plane trust domain, as used by the issuer dapr Sentry
+			// generates itself.
+			DNSNames:    []string{daprConf.trustDomains[0]},
+			IsCA:        true,
+			Duration:    &metav1.Duration{Duration: s.provision.Duration},
+			RenewBefore: &metav1.Duration{Duration: s.provision.RenewBefore},
+			Usages:      []cmapi.KeyUsage{cmapi.UsageCertSign, cmapi.UsageCRLSign, cmapi.UsageDigitalSignature},
+			PrivateKey: &cmapi.CertificatePrivateKey{
+				Algorithm:      s.provision.PrivateKeyAlgorithm,
+				Size:           s.provision.PrivateKeySize,
+				RotationPolicy: cmapi.RotationPolicyAlways,
+			},
+			IssuerRef: s.provision.IssuerRef,
+		},
+	}
+}
+
+// provisionedSecretName returns the name of the cert-manager Secret of the
+// provisioned Certificate with the given name.
+func provisionedSecretName(certName string) string {
+	return certName + "-from-cert-manager"
+}
+
+// provisionCertificate creates the cert-manager Certificate of the secretConf
+// if current is nil, or updates current to the provisioned spec if it was
+// provisioned by dapr-cert-manager and has drifted. Certificates which were
+// not provisioned are never modified.
+func (s *secretCtrl) provisionCertificate(ctx context.Context, log logr.Logger, namespace string, conf secretConf, daprConf daprSystemConfig, current *cmapi.Certificate) error {
+	if current != nil && current.Labels[labelProvisioned] != "true" {
+		return nil
+	}
+
+	if s.provision.RenewBefore <= daprConf.workloadCertTTL {
+		return fmt.Errorf("refusing to provision cert-manager Certificate %q: renew before %s is not longer than the dapr workload certificate TTL %s",
+			conf.certName, s.provision.RenewBefore, daprConf.workloadCertTTL)
+	}
+
+	desired := s.provisionedCertificate(namespace, conf, daprConf)
+
+	if current == nil {
+		if s.dryRun {
+			log.Info("dry run: would provision cert-manager Certificate")
+			return nil
+		}
+		log.Info("provisioning cert-manager Certificate", "issuer", desired.Spec.IssuerRef.Name, "issuer_kind", desired.Spec.IssuerRef.Kind)
+		if err := s.client.Create(ctx, desired, client.FieldOwner(fieldManager)); err != nil {
+			return fmt.Errorf("failed to provision cert-manager Certificate %q: %w", conf.certName, err)
+		}
+		return nil
+	}
+
+	if equality.Semantic.DeepEqual(current.Spec, desired.Spec) {
+		return nil
+	}
+
+	if s.dryRun {
+		log.Info("dry run: would update provisioned cert-manager Certificate")
+		return nil
+	}
+
+	orig := current.DeepCopy()
+	current.Spec = desired.Spec
+	log.Info("updating provisioned cert-manager Certificate", "issuer", desired.Spec.IssuerRef.Name, "issuer_kind", desired.Spec.IssuerRef.Kind)
+	if err := s.client.Patch(ctx, current, client.MergeFrom(orig), client.FieldOwner(fieldManager)); err != nil {
+		return fmt.Errorf("failed to update provisioned cert-manager Certificate %q: %w", conf.certName, err)
+	}
+
+	return nil
+}
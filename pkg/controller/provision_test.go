@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_provisionCertificate(t *testing.T) {
+	now := time.Now()
+
+	conf := testSecretConf
+	conf.provision = true
+
+	opts := ProvisionOptions{
+		Enabled:             true,
+		IssuerRef:           cmmeta.ObjectReference{Name: "dapr-root-ca", Kind: "Issuer", Group: "cert-manager.io"},
+		Duration:            time.Hour * 24 * 90,
+		RenewBefore:         time.Hour * 24 * 30,
+		PrivateKeyAlgorithm: cmapi.ECDSAKeyAlgorithm,
+		PrivateKeySize:      256,
+	}
+
+	tests := map[string]struct {
+		existing     *cmapi.Certificate
+		renewBefore  time.Duration
+		expError     bool
+		expIssuerRef string
+	}{
+		"a missing Certificate is provisioned": {
+			expIssuerRef: "dapr-root-ca",
+		},
+		"a provisioned Certificate which has drifted is updated": {
+			existing: &cmapi.Certificate{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "dapr-system", Name: "dapr-trust-bundle",
+					Labels: map[string]string{labelProvisioned: "true"},
+				},
+				Spec: cmapi.CertificateSpec{
+					SecretName: "dapr-trust-bundle-from-cert-manager",
+					IssuerRef:  cmmeta.ObjectReference{Name: "old-root-ca"},
+				},
+			},
+			expIssuerRef: "dapr-root-ca",
+		},
+		"a Certificate which was not provisioned is never modified": {
+			existing: &cmapi.Certificate{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+				Spec: cmapi.CertificateSpec{
+					SecretName: "dapr-trust-bundle-from-cert-manager",
+					IssuerRef:  cmmeta.ObjectReference{Name: "user-root-ca"},
+				},
+			},
+			expIssuerRef: "user-root-ca",
+		},
+		"a renew before which is not longer than the workload certificate TTL is refused": {
+			renewBefore: time.Hour,
+			expError:    true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var objs []client.Object
+			if test.existing != nil {
+				objs = append(objs, test.existing)
+			}
+			s, _ := newTestSecretCtrl(t, now, objs...)
+			s.provision = opts
+			if test.renewBefore > 0 {
+				s.provision.RenewBefore = test.renewBefore
+			}
+
+			_, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", conf, defaultDaprSystemConfig())
+			if (err != nil) != test.expError {
+				t.Fatalf("expected error=%t, got %v", test.expError, err)
+			}
+			if test.expError {
+				return
+			}
+
+			var cert cmapi.Certificate
+			if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &cert); err != nil {
+				t.Fatal(err)
+			}
+			if cert.Spec.IssuerRef.Name != test.expIssuerRef {
+				t.Errorf("expected issuerRef %q, got %q", test.expIssuerRef, cert.Spec.IssuerRef.Name)
+			}
+			if test.existing != nil && test.existing.Labels[labelProvisioned] != "true" {
+				return
+			}
+
+			if !cert.Spec.IsCA {
+				t.Error("expected provisioned Certificate to be a CA")
+			}
+			if cert.Spec.PrivateKey == nil || cert.Spec.PrivateKey.RotationPolicy != cmapi.RotationPolicyAlways ||
+				cert.Spec.PrivateKey.Algorithm != cmapi.ECDSAKeyAlgorithm {
+				t.Errorf("unexpected provisioned private key: %+v", cert.Spec.PrivateKey)
+			}
+			if cert.Spec.RenewBefore == nil || cert.Spec.RenewBefore.Duration != opts.RenewBefore {
+				t.Errorf("unexpected provisioned renew before: %v", cert.Spec.RenewBefore)
+			}
+			if len(cert.Spec.DNSNames) != 1 || cert.Spec.DNSNames[0] != "cluster.local" {
+				t.Errorf("unexpected provisioned DNS names: %v", cert.Spec.DNSNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+)
+
+// pruneExpiredTrustAnchors removes all trust anchors from the bundle which
+// expired longer than the grace period ago. Trust anchors which any of the
+// given issuer chains chain to are never removed, regardless of their expiry.
+// Returns the trust anchors which were removed from the bundle.
+func pruneExpiredTrustAnchors(bundle *x509bundle.Bundle, issuers [][]*x509.Certificate, now time.Time, grace time.Duration) []*x509.Certificate {
+	var pruned []*x509.Certificate
+	for _, anchor := range bundle.X509Authorities() {
+		if !now.After(anchor.NotAfter.Add(grace)) {
+			continue
+		}
+
+		var inUse bool
+		for _, issuer := range issuers {
+			if chainsTo(issuer, anchor) {
+				inUse = true
+				break
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		bundle.RemoveX509Authority(anchor)
+		pruned = append(pruned, anchor)
+	}
+
+	return pruned
+}
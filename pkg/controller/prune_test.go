@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+func Test_pruneExpiredTrustAnchors(t *testing.T) {
+	now := time.Now()
+	valid := genCA(t, "valid", nil, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := genCA(t, "expired", nil, now.Add(-time.Hour*3), now.Add(-time.Hour*2))
+	expiredInUse := genCA(t, "expired-in-use", nil, now.Add(-time.Hour*3), now.Add(-time.Hour*2))
+	issuer := genCA(t, "issuer", expiredInUse, now.Add(-time.Hour*3), now.Add(-time.Hour*2))
+
+	tests := map[string]struct {
+		issuers   [][]*x509.Certificate
+		grace     time.Duration
+		expPruned []*x509.Certificate
+		expBundle []*x509.Certificate
+	}{
+		"no grace period should prune all expired not in use": {
+			issuers:   [][]*x509.Certificate{{issuer.cert}},
+			grace:     0,
+			expPruned: []*x509.Certificate{expired.cert},
+			expBundle: []*x509.Certificate{valid.cert, expiredInUse.cert},
+		},
+		"grace period not yet passed should prune nothing": {
+			issuers:   [][]*x509.Certificate{{issuer.cert}},
+			grace:     time.Hour * 3,
+			expPruned: nil,
+			expBundle: []*x509.Certificate{valid.cert, expired.cert, expiredInUse.cert},
+		},
+		"no issuers should prune all expired": {
+			issuers:   nil,
+			grace:     time.Hour,
+			expPruned: []*x509.Certificate{expired.cert, expiredInUse.cert},
+			expBundle: []*x509.Certificate{valid.cert},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bundle := x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, []*x509.Certificate{
+				valid.cert, expired.cert, expiredInUse.cert,
+			})
+
+			pruned := pruneExpiredTrustAnchors(bundle, test.issuers, now, test.grace)
+			if !x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, pruned).Equal(
+				x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, test.expPruned)) {
+				t.Errorf("unexpected pruned trust anchors, exp=%d got=%d", len(test.expPruned), len(pruned))
+			}
+			if !bundle.Equal(x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, test.expBundle)) {
+				t.Errorf("unexpected trust bundle, exp=%d got=%d", len(test.expBundle), len(bundle.X509Authorities()))
+			}
+		})
+	}
+}
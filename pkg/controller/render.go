@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/clock"
+)
+
+// RenderOptions configure RenderTrustBundle.
+type RenderOptions struct {
+	Log logr.Logger
+
+	// Source is the cert-manager Secret containing the issuer certificate,
+	// private key and optionally `ca.crt`.
+	Source corev1.Secret
+
+	// Current is the current dapr trust-bundle Secret, whose trust anchors are
+	// merged with the trust anchors of the source. Its name and namespace are
+	// used for the rendered Secret. Defaults to `dapr-trust-bundle` in the
+	// namespace of the source if it has no name.
+	Current corev1.Secret
+
+	// TrustAnchor is used for the trust-bundle trust anchors. If nil, the
+	// `ca.crt` of Source will be used.
+	TrustAnchor x509bundle.Source
+
+	// PruneExpiredTrustAnchors, TrustAnchorPruneGracePeriod and
+	// ReplaceTrustAnchors are as for Options.
+	PruneExpiredTrustAnchors    bool
+	TrustAnchorPruneGracePeriod time.Duration
+	ReplaceTrustAnchors         bool
+}
+
+// RenderTrustBundle returns the dapr trust-bundle Secret which the
+// trust-bundle controller would write from the given cert-manager Secret,
+// without reading or writing any resources. The same merge and validation is
+// applied as by the controller, using the default dapr system Configuration.
+// Only the name, namespace, labels and annotations of the current Secret are
+// kept, so that the rendered Secret can be committed to source control.
+func RenderTrustBundle(opts RenderOptions) (*corev1.Secret, error) {
+	secCtl := &secretCtrl{
+		log:                 opts.Log.WithName("render"),
+		clock:               clock.RealClock{},
+		pruneTrustAnchors:   opts.PruneExpiredTrustAnchors,
+		pruneGracePeriod:    opts.TrustAnchorPruneGracePeriod,
+		replaceTrustAnchors: opts.ReplaceTrustAnchors,
+	}
+
+	if !hasIssuerData(opts.Source) {
+		return nil, errors.New("cert-manager Secret has no issuer certificate or private key")
+	}
+
+	current := *opts.Current.DeepCopy()
+	if len(current.Name) == 0 {
+		current.Name = "dapr-trust-bundle"
+	}
+	if len(current.Namespace) == 0 {
+		current.Namespace = opts.Source.Namespace
+	}
+
+	conf := secretConf{
+		certSecretName:  current.Name,
+		caSecretName:    current.Name,
+		certSectretKey:  v1alpha1.DefaultCertificateKey,
+		certSecretPKKey: v1alpha1.DefaultPrivateKeyKey,
+		certSecretCAKey: v1alpha1.DefaultCAKey,
+	}
+
+	update, shouldReconcile, err := secCtl.shouldReconcileSecret(secCtl.log, secCtl.log.V(3), conf,
+		defaultDaprSystemConfig(), opts.TrustAnchor, current, current, opts.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        current.Name,
+			Namespace:   current.Namespace,
+			Labels:      current.Labels,
+			Annotations: current.Annotations,
+		},
+		Type: current.Type,
+		Data: make(map[string][]byte),
+	}
+	for key, value := range current.Data {
+		rendered.Data[key] = value
+	}
+
+	if !shouldReconcile {
+		return rendered, nil
+	}
+
+	rendered.Data[conf.certSectretKey] = opts.Source.Data[corev1.TLSCertKey]
+	rendered.Data[conf.certSecretPKKey] = opts.Source.Data[corev1.TLSPrivateKeyKey]
+
+	taPEM, err := update.trustAnchors.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal trust anchors: %w", err)
+	}
+	rendered.Data[conf.certSecretCAKey] = taPEM
+
+	return rendered, nil
+}
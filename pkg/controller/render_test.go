@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_RenderTrustBundle(t *testing.T) {
+	now := time.Now()
+	oldRoot := genCA(t, "old-root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	expired := genCA(t, "expired", root, now.Add(-time.Hour*2), now.Add(-time.Hour))
+
+	source := func(issuer *testCA) corev1.Secret {
+		return corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle-from-cert-manager"},
+			Data: map[string][]byte{
+				"tls.crt": certPEM(issuer.cert),
+				"tls.key": keyPEM(t, issuer.key),
+				"ca.crt":  certPEM(root.cert),
+			},
+		}
+	}
+
+	tests := map[string]struct {
+		opts     RenderOptions
+		expError bool
+		expData  map[string][]byte
+	}{
+		"no current Secret renders the issuer and trust anchor": {
+			opts: RenderOptions{Source: source(issuer)},
+			expData: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(root.cert),
+			},
+		},
+		"trust anchors of the current Secret are kept, and other keys preserved": {
+			opts: RenderOptions{
+				Source: source(issuer),
+				Current: corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "dapr-system", Name: "dapr-trust-bundle",
+						ResourceVersion: "1", UID: "abc",
+					},
+					Data: map[string][]byte{
+						"ca.crt":    certPEM(oldRoot.cert),
+						"other-key": []byte("value"),
+					},
+				},
+			},
+			expData: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     append(certPEM(oldRoot.cert), certPEM(root.cert)...),
+				"other-key":  []byte("value"),
+			},
+		},
+		"an issuer which fails validation is refused": {
+			opts:     RenderOptions{Source: source(expired)},
+			expError: true,
+		},
+		"a Secret without issuer data is refused": {
+			opts:     RenderOptions{Source: corev1.Secret{}},
+			expError: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.opts.Log = logr.Discard()
+			secret, err := RenderTrustBundle(test.opts)
+			if (err != nil) != test.expError {
+				t.Fatalf("expected error=%t, got %v", test.expError, err)
+			}
+			if test.expError {
+				return
+			}
+
+			if secret.Name != "dapr-trust-bundle" || secret.Namespace != "dapr-system" {
+				t.Errorf("unexpected rendered Secret %s/%s", secret.Namespace, secret.Name)
+			}
+			if len(secret.ResourceVersion) > 0 || len(secret.UID) > 0 {
+				t.Error("expected server populated metadata to be dropped")
+			}
+			if len(secret.Data) != len(test.expData) {
+				t.Errorf("expected %d keys, got %d", len(test.expData), len(secret.Data))
+			}
+			for key, value := range test.expData {
+				if !bytes.Equal(secret.Data[key], value) {
+					t.Errorf("unexpected data for key %q: %q", key, secret.Data[key])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// annotationRootRotation is the annotation of the dapr CA Secret which
+	// persists the status of the current root CA rotation.
+	annotationRootRotation = "dapr-cert-manager.diagrid.io/root-rotation"
+)
+
+// rotationPhase is a phase of a root CA rotation.
+type rotationPhase string
+
+const (
+	// rotationPhaseDistributing is the phase in which the new root CA has been
+	// added to the trust bundle alongside the old root CA. The issuer signed by
+	// the new root CA is held back until the soak period has passed, so that
+	// every workload trusts the new root CA before it is used.
+	rotationPhaseDistributing rotationPhase = "Distributing"
+
+	// rotationPhaseIssuerSwitched is the phase in which the issuer signed by
+	// the new root CA has been written. The old root CA is removed from the
+	// trust bundle once the soak period has passed, so that every workload
+	// has been issued a certificate by the new issuer.
+	rotationPhaseIssuerSwitched rotationPhase = "IssuerSwitched"
+
+	// rotationPhaseComplete is the phase in which the old root CA has been
+	// removed from the trust bundle.
+	rotationPhaseComplete rotationPhase = "Complete"
+)
+
+// rotationStatus is the status of a root CA rotation, persisted as JSON in the
+// annotationRootRotation annotation of the dapr CA Secret.
+type rotationStatus struct {
+	// Phase is the current phase of the rotation.
+	Phase rotationPhase `json:"phase"`
+
+	// NewRoot is the SHA-256 fingerprint of the root CA being rotated to.
+	NewRoot string `json:"newRoot"`
+
+	// OldRoots are the SHA-256 fingerprints of the root CAs being rotated
+	// from.
+	OldRoots []string `json:"oldRoots,omitempty"`
+
+	// PhaseStartTime is the time the current phase started.
+	PhaseStartTime time.Time `json:"phaseStartTime"`
+}
+
+// rootRotationStatus returns the root CA rotation status persisted on the
+// given dapr CA Secret. Returns nil if there is no valid status.
+func rootRotationStatus(log logr.Logger, secret corev1.Secret) *rotationStatus {
+	value, ok := secret.Annotations[annotationRootRotation]
+	if !ok {
+		return nil
+	}
+
+	var status rotationStatus
+	if err := json.Unmarshal([]byte(value), &status); err != nil {
+		log.Error(err, "ignoring invalid root CA rotation status annotation", "annotation", annotationRootRotation)
+		return nil
+	}
+
+	return &status
+}
+
+// rotateRoot advances the root CA rotation from the root CA of the current
+// dapr issuer to the root CA of the cert-manager issuer, gating each phase on
+// the soak period. The desired trust bundle is modified in place so that old
+// root CAs are kept until the rotation is complete. The issuer is held back
+// by setting holdIssuer on the update, and the new status to persist is set
+// on the update if it has changed.
+func (s *secretCtrl) rotateRoot(log logr.Logger, conf secretConf,
+	daprCertSecret, daprCASecret, cmSecret corev1.Secret,
+	currentTA, daprTA *x509bundle.Bundle, update *bundleUpdate,
+) {
+	now := s.clock.Now()
+	status := rootRotationStatus(log, daprCASecret)
+
+	var currentRoot, newRoot *x509.Certificate
+	if chain, err := parseCertificates(daprCertSecret.Data[conf.certSectretKey]); err == nil {
+		currentRoot = issuerRoot(chain, currentTA)
+	}
+	if chain, err := parseCertificates(cmSecret.Data[corev1.TLSCertKey]); err == nil {
+		newRoot = issuerRoot(chain, daprTA)
+	}
+
+	remaining := func(status *rotationStatus) time.Duration {
+		return status.PhaseStartTime.Add(s.rootRotationSoakPeriod).Sub(now)
+	}
+
+	setPhase := func(phase rotationPhase) {
+		next := &rotationStatus{
+			Phase:          phase,
+			NewRoot:        status.NewRoot,
+			OldRoots:       status.OldRoots,
+			PhaseStartTime: now,
+		}
+		log.Info("root CA rotation entered phase", "phase", phase, "new_root", next.NewRoot, "old_roots", next.OldRoots)
+		status = next
+		update.rotation = next
+	}
+
+	switch {
+	// The issuer is being replaced by one which chains to a different root CA,
+	// so the new root CA must be distributed before the issuer is switched.
+	case update.issuer != nil && currentRoot != nil && newRoot != nil && !currentRoot.Equal(newRoot):
+		if status == nil || status.NewRoot != fingerprint(newRoot) || status.Phase != rotationPhaseDistributing {
+			status = &rotationStatus{
+				NewRoot:  fingerprint(newRoot),
+				OldRoots: []string{fingerprint(currentRoot)},
+			}
+			setPhase(rotationPhaseDistributing)
+		}
+
+		if wait := remaining(status); wait > 0 {
+			log.Info("holding back issuer until its root CA has been distributed for the soak period", "remaining", wait)
+			update.holdIssuer = true
+			update.requeueAfter = wait
+			break
+		}
+
+		setPhase(rotationPhaseIssuerSwitched)
+		update.requeueAfter = s.rootRotationSoakPeriod
+
+	// The issuer was switched by a previous reconcile which failed to persist
+	// the status.
+	case status != nil && status.Phase == rotationPhaseDistributing &&
+		currentRoot != nil && fingerprint(currentRoot) == status.NewRoot:
+		setPhase(rotationPhaseIssuerSwitched)
+		update.requeueAfter = s.rootRotationSoakPeriod
+
+	case status != nil && status.Phase == rotationPhaseIssuerSwitched:
+		if wait := remaining(status); wait > 0 {
+			update.requeueAfter = wait
+			break
+		}
+		setPhase(rotationPhaseComplete)
+	}
+
+	if status == nil {
+		return
+	}
+
+	// Keep the old root CAs in the trust bundle until the rotation is
+	// complete, after which they are never re-added unless the current issuer
+	// chains to them.
+	if status.Phase != rotationPhaseComplete {
+		for _, cert := range currentTA.X509Authorities() {
+			if slices.Contains(status.OldRoots, fingerprint(cert)) && !daprTA.HasX509Authority(cert) {
+				daprTA.AddX509Authority(cert)
+			}
+		}
+		return
+	}
+
+	for _, cert := range daprTA.X509Authorities() {
+		if slices.Contains(status.OldRoots, fingerprint(cert)) && !cert.Equal(currentRoot) {
+			daprTA.RemoveX509Authority(cert)
+		}
+	}
+}
+
+// issuerRoot returns the trust anchor of the bundle which the given issuer
+// chain chains to. Returns nil if the chain does not chain to any trust
+// anchor.
+func issuerRoot(chain []*x509.Certificate, bundle *x509bundle.Bundle) *x509.Certificate {
+	for _, anchor := range bundle.X509Authorities() {
+		if chainsTo(chain, anchor) {
+			return anchor
+		}
+	}
+	return nil
+}
+
+// marshalRotationStatus returns the annotation value of the given root CA
+// rotation status.
+func marshalRotationStatus(status *rotationStatus) (string, error) {
+	b, err := json.Marshal(status)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal root CA rotation status: %w", err)
+	}
+	return string(b), nil
+}
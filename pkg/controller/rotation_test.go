@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_rotateRoot(t *testing.T) {
+	now := time.Now()
+	soak := time.Hour
+	oldRoot := genCA(t, "old-root", nil, now.Add(-time.Hour*48), now.Add(time.Hour*48))
+	oldIssuer := genCA(t, "old-issuer", oldRoot, now.Add(-time.Hour*48), now.Add(time.Hour*47))
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	s, recorder := newTestSecretCtrl(t, now, testObjects(t, issuer, root, map[string][]byte{
+		"issuer.crt": certPEM(oldIssuer.cert),
+		"issuer.key": keyPEM(t, oldIssuer.key),
+		"ca.crt":     certPEM(oldRoot.cert),
+	})...)
+	s.rootRotationSoakPeriod = soak
+	fakeClock := s.clock.(*clocktesting.FakePassiveClock)
+
+	expState := func(expPhase rotationPhase, expEvent bool, expIssuer *testCA, expRequeue time.Duration, expRoots ...*testCA) {
+		t.Helper()
+
+		requeue, err := s.reconcileBundle(context.Background(), s.log, "dapr-system", testSecretConf, defaultDaprSystemConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requeue != expRequeue {
+			t.Errorf("expected requeue after %s, got %s", expRequeue, requeue)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(context.Background(), client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(secret.Data["issuer.crt"], certPEM(expIssuer.cert)) {
+			t.Errorf("expected issuer %q in dapr Secret", expIssuer.cert.Subject.CommonName)
+		}
+
+		var roots []byte
+		for _, root := range expRoots {
+			roots = append(roots, certPEM(root.cert)...)
+		}
+		if !bytes.Equal(secret.Data["ca.crt"], roots) {
+			t.Errorf("expected %d trust anchors in dapr Secret, got %q", len(expRoots), secret.Data["ca.crt"])
+		}
+
+		status := rootRotationStatus(s.log, secret)
+		if status == nil {
+			t.Fatal("expected root rotation status annotation")
+		}
+		if status.Phase != expPhase {
+			t.Errorf("expected phase %s, got %s", expPhase, status.Phase)
+		}
+		if status.NewRoot != fingerprint(root.cert) {
+			t.Errorf("expected new root %s, got %s", fingerprint(root.cert), status.NewRoot)
+		}
+
+		events := strings.Join(drainEvents(recorder), "\n")
+		if strings.Contains(events, reasonRootRotation) != expEvent {
+			t.Errorf("expected %s event=%t, got %q", reasonRootRotation, expEvent, events)
+		}
+	}
+
+	// The new root is distributed, and the new issuer is held back.
+	expState(rotationPhaseDistributing, true, oldIssuer, soak, oldRoot, root)
+
+	// The new issuer is still held back before the soak period has passed.
+	fakeClock.SetTime(now.Add(time.Minute))
+	expState(rotationPhaseDistributing, false, oldIssuer, soak-time.Minute, oldRoot, root)
+
+	// The new issuer is written once the new root has soaked, and the old root
+	// is kept.
+	fakeClock.SetTime(now.Add(soak))
+	expState(rotationPhaseIssuerSwitched, true, issuer, soak, oldRoot, root)
+
+	// The old root is removed once the new issuer has soaked.
+	fakeClock.SetTime(now.Add(soak * 2))
+	expState(rotationPhaseComplete, true, issuer, 0, root)
+
+	// The old root is never re-added.
+	fakeClock.SetTime(now.Add(soak * 3))
+	expState(rotationPhaseComplete, false, issuer, 0, root)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Status is the live state of the dapr Secrets of a single dapr certificate
+// configuration. Certificates are summarised, and never contain PEM data.
+type Status struct {
+	// Namespace is the dapr namespace of the Secrets.
+	Namespace string `json:"namespace"`
+
+	// CertificateName is the name of the source cert-manager Certificate.
+	CertificateName string `json:"certificateName"`
+
+	// CertificateSecretName is the name of the cert-manager Secret of the
+	// Certificate. Empty if the Certificate does not exist.
+	CertificateSecretName string `json:"certificateSecretName,omitempty"`
+
+	// SecretName is the name of the dapr Secret containing the issuer.
+	SecretName string `json:"secretName"`
+
+	// CASecretName is the name of the dapr Secret containing the trust bundle.
+	CASecretName string `json:"caSecretName,omitempty"`
+
+	// Issuer is the issuer certificate in the dapr Secret. Nil if there is no
+	// valid issuer.
+	Issuer *CertificateSummary `json:"issuer,omitempty"`
+
+	// TrustAnchors are the trust anchors in the dapr trust bundle.
+	TrustAnchors []CertificateSummary `json:"trustAnchors,omitempty"`
+
+	// InSync is true if the issuer in the dapr Secret is the issuer in the
+	// cert-manager Secret, and the dapr trust bundle contains the `ca.crt` of
+	// the cert-manager Secret.
+	InSync bool `json:"inSync"`
+
+	// IssuerChainsToBundle is true if the issuer in the dapr Secret chains to
+	// a trust anchor in the dapr trust bundle.
+	IssuerChainsToBundle bool `json:"issuerChainsToBundle"`
+
+	// Paused is true if reconciliation of the dapr Secret is paused.
+	Paused bool `json:"paused,omitempty"`
+
+	// Error is the reason the status could not be fully determined, for
+	// example because a Secret does not exist.
+	Error string `json:"error,omitempty"`
+}
+
+// StatusTrustBundle returns the live state of every dapr Secret the
+// trust-bundle controller manages. The given reader is used to read all
+// resources.
+func StatusTrustBundle(ctx context.Context, reader client.Reader, opts Options) ([]Status, error) {
+	secCtl, err := newSecretCtrl(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	secCtl.lister = reader
+	secCtl.apiReader = reader
+	secCtl.secretReader = reader
+
+	namespaces, err := secCtl.managedNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list managed dapr namespaces: %w", err)
+	}
+	sort.Strings(namespaces)
+
+	var statuses []Status
+	for _, namespace := range namespaces {
+		confs, err := secCtl.secretConfs(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, conf := range confs {
+			status := Status{
+				Namespace:       namespace,
+				CertificateName: conf.certName,
+				SecretName:      conf.certSecretName,
+				CASecretName:    conf.caSecretName,
+			}
+			if err := secCtl.status(ctx, namespace, conf, &status); err != nil {
+				status.Error = err.Error()
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	return statuses, nil
+}
+
+// status populates the given Status from the live state of the given dapr
+// certificate configuration.
+func (s *secretCtrl) status(ctx context.Context, namespace string, conf secretConf, status *Status) error {
+	var daprCertSecret corev1.Secret
+	if err := s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: conf.certSecretName}, &daprCertSecret); err != nil {
+		return fmt.Errorf("failed to get dapr certificate Secret: %w", err)
+	}
+	status.Paused = paused(daprCertSecret)
+
+	chain, err := parseCertificates(daprCertSecret.Data[conf.certSectretKey])
+	if err == nil {
+		issuer := summarizeCertificate(chain[0])
+		status.Issuer = &issuer
+	}
+
+	daprTA := x509bundle.New(spiffeid.TrustDomain{})
+	if len(conf.caSecretName) > 0 {
+		daprCASecret := daprCertSecret
+		if conf.caSecretName != conf.certSecretName {
+			if err := s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: conf.caSecretName}, &daprCASecret); err != nil {
+				return fmt.Errorf("failed to get dapr CA certificate Secret: %w", err)
+			}
+		}
+		if ta, err := x509bundle.Parse(spiffeid.TrustDomain{}, daprCASecret.Data[conf.certSecretCAKey]); err == nil {
+			daprTA = ta
+		}
+		for _, cert := range daprTA.X509Authorities() {
+			status.TrustAnchors = append(status.TrustAnchors, summarizeCertificate(cert))
+		}
+	}
+
+	status.IssuerChainsToBundle = status.Issuer != nil && issuerRoot(chain, daprTA) != nil
+
+	var cert cmapi.Certificate
+	if err := s.lister.Get(ctx, types.NamespacedName{Namespace: namespace, Name: conf.certName}, &cert); err != nil {
+		return fmt.Errorf("failed to get cert-manager Certificate: %w", err)
+	}
+	status.CertificateSecretName = cert.Spec.SecretName
+
+	var cmSecret corev1.Secret
+	if err := s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: cert.Spec.SecretName}, &cmSecret); err != nil {
+		return fmt.Errorf("failed to get cert-manager Secret: %w", err)
+	}
+
+	status.InSync = hasIssuerData(cmSecret) && !issuerPending(conf, daprCertSecret, cmSecret)
+	if status.InSync && len(conf.caSecretName) > 0 && len(cmSecret.Data[cmmeta.TLSCAKey]) > 0 {
+		cmTA, err := x509bundle.Parse(spiffeid.TrustDomain{}, cmSecret.Data[cmmeta.TLSCAKey])
+		if err != nil {
+			return fmt.Errorf("failed to parse ca.crt of cert-manager Secret: %w", err)
+		}
+		for _, cert := range cmTA.X509Authorities() {
+			if !daprTA.HasX509Authority(cert) {
+				status.InSync = false
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_status(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	otherRoot := genCA(t, "other-root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	oldIssuer := genCA(t, "old-issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	tests := map[string]struct {
+		daprData          map[string][]byte
+		expIssuer         *testCA
+		expTrustAnchors   int
+		expInSync         bool
+		expChainsToBundle bool
+	}{
+		"in sync": {
+			daprData: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(root.cert),
+			},
+			expIssuer:         issuer,
+			expTrustAnchors:   1,
+			expInSync:         true,
+			expChainsToBundle: true,
+		},
+		"out of date issuer": {
+			daprData: map[string][]byte{
+				"issuer.crt": certPEM(oldIssuer.cert),
+				"issuer.key": keyPEM(t, oldIssuer.key),
+				"ca.crt":     certPEM(root.cert),
+			},
+			expIssuer:         oldIssuer,
+			expTrustAnchors:   1,
+			expInSync:         false,
+			expChainsToBundle: true,
+		},
+		"issuer does not chain to bundle": {
+			daprData: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(otherRoot.cert),
+			},
+			expIssuer:         issuer,
+			expTrustAnchors:   1,
+			expInSync:         false,
+			expChainsToBundle: false,
+		},
+		"empty dapr Secret": {
+			daprData:          nil,
+			expIssuer:         nil,
+			expTrustAnchors:   0,
+			expInSync:         false,
+			expChainsToBundle: false,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, _ := newTestSecretCtrl(t, now, testObjects(t, issuer, root, test.daprData)...)
+
+			status := Status{}
+			if err := s.status(context.Background(), "dapr-system", testSecretConf, &status); err != nil {
+				t.Fatal(err)
+			}
+
+			if (status.Issuer == nil) != (test.expIssuer == nil) ||
+				(test.expIssuer != nil && status.Issuer.Fingerprint != fingerprint(test.expIssuer.cert)) {
+				t.Errorf("unexpected issuer %+v", status.Issuer)
+			}
+			if len(status.TrustAnchors) != test.expTrustAnchors {
+				t.Errorf("expected %d trust anchors, got %d", test.expTrustAnchors, len(status.TrustAnchors))
+			}
+			if status.InSync != test.expInSync {
+				t.Errorf("expected in sync=%t, got %t", test.expInSync, status.InSync)
+			}
+			if status.IssuerChainsToBundle != test.expChainsToBundle {
+				t.Errorf("expected issuer chains to bundle=%t, got %t", test.expChainsToBundle, status.IssuerChainsToBundle)
+			}
+		})
+	}
+}
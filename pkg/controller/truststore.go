@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/diagridio/dapr-cert-manager/pkg/apis/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const (
+	// truststoreSecretName is the name of the dapr Secret whose trust bundle
+	// is rendered into truststores, which are written to the same Secret.
+	truststoreSecretName = "dapr-trust-bundle"
+
+	// annotationTruststoreHash is the annotation of the dapr Secret which
+	// persists the hash of the trust bundle, password Secret revision and keys
+	// the truststores were rendered from. Truststores are not deterministic,
+	// so they are only rendered again when the hash changes. The password
+	// itself is never hashed, so that it can't be recovered from the
+	// annotation.
+	annotationTruststoreHash = "dapr-cert-manager.diagrid.io/truststore-hash"
+
+	// Steps of writing the truststores to the dapr Secret.
+	writeStepTruststores = "truststores"
+)
+
+// PKCS12 profiles of the encryption and MAC algorithms of PKCS#12
+// truststores, matching those of cert-manager Certificate keystores.
+const (
+	PKCS12ProfileLegacyRC2  = "LegacyRC2"
+	PKCS12ProfileLegacyDES  = "LegacyDES"
+	PKCS12ProfileModern2023 = "Modern2023"
+)
+
+// TruststoreOptions configure the PKCS#12 and JKS truststores which the trust
+// bundle of the dapr trust-bundle Secret is additionally written as.
+type TruststoreOptions struct {
+	// PKCS12Key is the key of the dapr trust-bundle Secret to write the
+	// PKCS#12 truststore to. Not written if empty.
+	PKCS12Key string
+
+	// PKCS12Profile is the profile of the PKCS#12 truststore. Defaults to
+	// PKCS12ProfileLegacyRC2.
+	PKCS12Profile string
+
+	// JKSKey is the key of the dapr trust-bundle Secret to write the JKS
+	// truststore to. Not written if empty.
+	JKSKey string
+
+	// PasswordSecretName and PasswordSecretKey reference the key of a Secret,
+	// in the same namespace as the dapr trust-bundle Secret, which contains the
+	// password of the truststores.
+	PasswordSecretName string
+	PasswordSecretKey  string
+}
+
+// enabled returns true if any truststore is written.
+func (o TruststoreOptions) enabled() bool {
+	return len(o.PKCS12Key) > 0 || len(o.JKSKey) > 0
+}
+
+// pkcs12Encoder returns the PKCS#12 encoder of the profile.
+func pkcs12Encoder(profile string) (*pkcs12.Encoder, error) {
+	switch profile {
+	case "", PKCS12ProfileLegacyRC2:
+		return pkcs12.LegacyRC2, nil
+	case PKCS12ProfileLegacyDES:
+		return pkcs12.LegacyDES, nil
+	case PKCS12ProfileModern2023:
+		return pkcs12.Modern2023, nil
+	default:
+		return nil, fmt.Errorf("unknown PKCS#12 profile %q", profile)
+	}
+}
+
+// reconcileTruststores ensures the dapr trust-bundle Secret contains the
+// truststores rendered from its trust bundle. The truststores are rendered
+// after the trust bundle has been written, and so always contain the same
+// trust anchors.
+func (s *secretCtrl) reconcileTruststores(ctx context.Context, log logr.Logger, namespace string) error {
+	log = log.WithValues("dapr_namespace", namespace, "secret", truststoreSecretName)
+	dbg := log.V(3)
+
+	var daprSecret corev1.Secret
+	err := s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: truststoreSecretName}, &daprSecret)
+	if apierrors.IsNotFound(err) {
+		dbg.Info("dapr trust-bundle Secret does not exist")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if paused(daprSecret) {
+		log.Info("reconciliation of dapr truststores is paused", "annotation", AnnotationPaused)
+		return nil
+	}
+
+	taPEM := daprSecret.Data[v1alpha1.DefaultCAKey]
+	if len(taPEM) == 0 {
+		dbg.Info("dapr trust-bundle Secret has no trust anchors")
+		return nil
+	}
+
+	var passwordSecret corev1.Secret
+	err = s.secretReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: s.truststores.PasswordSecretName}, &passwordSecret)
+	if apierrors.IsNotFound(err) {
+		log.Error(err, "truststore password Secret does not exist", "password_secret", s.truststores.PasswordSecretName)
+		s.recordEvent(corev1.EventTypeWarning, reasonTargetSecretMissing,
+			fmt.Sprintf("truststore password Secret %q does not exist", s.truststores.PasswordSecretName), &daprSecret)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	password, ok := passwordSecret.Data[s.truststores.PasswordSecretKey]
+	if !ok {
+		return fmt.Errorf("truststore password Secret %q has no key %q",
+			s.truststores.PasswordSecretName, s.truststores.PasswordSecretKey)
+	}
+
+	hash := s.truststoreHash(taPEM, passwordSecret)
+	if daprSecret.Annotations[annotationTruststoreHash] == hash && s.hasTruststores(daprSecret) {
+		dbg.Info("dapr truststores are up to date")
+		return nil
+	}
+
+	if s.dryRun {
+		log.Info("dry run: would update dapr truststores")
+		return nil
+	}
+
+	data, err := renderTruststores(s.truststores, taPEM, string(password))
+	if err == nil {
+		err = s.patchTruststores(ctx, &daprSecret, data, hash)
+	}
+	if err := s.observeWriteStep(log, namespace, truststoreSecretName, writeStepTruststores, err, &daprSecret); err != nil {
+		return err
+	}
+
+	log.Info("updated dapr truststores")
+
+	return nil
+}
+
+// hasTruststores returns true if the Secret contains all truststore keys.
+func (s *secretCtrl) hasTruststores(secret corev1.Secret) bool {
+	for _, key := range []string{s.truststores.PKCS12Key, s.truststores.JKSKey} {
+		if len(key) > 0 && len(secret.Data[key]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// truststoreHash returns the hash of the inputs the truststores are rendered
+// from. A change of password is detected by the UID and resourceVersion of
+// the password Secret, rather than by hashing the password.
+func (s *secretCtrl) truststoreHash(taPEM []byte, passwordSecret corev1.Secret) string {
+	h := sha256.New()
+	for _, b := range [][]byte{taPEM, []byte(passwordSecret.UID), []byte(passwordSecret.ResourceVersion), []byte(s.truststores.PKCS12Key),
+		[]byte(s.truststores.PKCS12Profile), []byte(s.truststores.JKSKey)} {
+		// Length prefix each input so that inputs can't be shifted between
+		// each other.
+		fmt.Fprintf(h, "%d:", len(b))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// patchTruststores patches the truststore keys and hash annotation of the
+// dapr Secret.
+func (s *secretCtrl) patchTruststores(ctx context.Context, secret *corev1.Secret, data map[string][]byte, hash string) error {
+	orig := secret.DeepCopy()
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	for key, value := range data {
+		secret.Data[key] = value
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = make(map[string]string)
+	}
+	secret.Annotations[annotationTruststoreHash] = hash
+
+	return s.client.Patch(ctx, secret, client.MergeFrom(orig), client.FieldOwner(fieldManager))
+}
+
+// renderTruststores renders the trust bundle into the truststores configured
+// by the options, keyed by their Secret key.
+func renderTruststores(opts TruststoreOptions, taPEM []byte, password string) (map[string][]byte, error) {
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, taPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trust bundle: %w", err)
+	}
+	certs := bundle.X509Authorities()
+
+	data := make(map[string][]byte)
+
+	if len(opts.PKCS12Key) > 0 {
+		enc, err := pkcs12Encoder(opts.PKCS12Profile)
+		if err != nil {
+			return nil, err
+		}
+		pfx, err := enc.EncodeTrustStore(certs, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode PKCS#12 truststore: %w", err)
+		}
+		data[opts.PKCS12Key] = pfx
+	}
+
+	if len(opts.JKSKey) > 0 {
+		jks, err := encodeJKS(certs, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode JKS truststore: %w", err)
+		}
+		data[opts.JKSKey] = jks
+	}
+
+	return data, nil
+}
+
+// encodeJKS encodes the certificates as a JKS truststore. Each certificate is
+// aliased by its fingerprint.
+func encodeJKS(certs []*x509.Certificate, password string) ([]byte, error) {
+	ks := keystore.New(keystore.WithOrderedAliases())
+	for _, cert := range certs {
+		if err := ks.SetTrustedCertificateEntry(fingerprint(cert), keystore.TrustedCertificateEntry{
+			CreationTime: cert.NotBefore,
+			Certificate:  keystore.Certificate{Type: "X509", Content: cert.Raw},
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := ks.Store(&buf, []byte(password)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pavlo-v-chernykh/keystore-go/v4"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func Test_reconcileTruststores(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	newRoot := genCA(t, "new-root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+
+	daprSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "dapr-trust-bundle"},
+		Data:       map[string][]byte{"ca.crt": certPEM(root.cert)},
+	}
+	passwordSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "truststore-password"},
+		Data:       map[string][]byte{"password": []byte("changeit")},
+	}
+	s, _ := newTestSecretCtrl(t, now, daprSecret, passwordSecret)
+	s.truststores = TruststoreOptions{
+		PKCS12Key:          "truststore.p12",
+		JKSKey:             "truststore.jks",
+		PasswordSecretName: "truststore-password",
+		PasswordSecretKey:  "password",
+	}
+
+	ctx := context.Background()
+	expTruststores := func(password string, expFingerprints ...string) corev1.Secret {
+		t.Helper()
+
+		if err := s.reconcileTruststores(ctx, s.log, "dapr-system"); err != nil {
+			t.Fatal(err)
+		}
+
+		var secret corev1.Secret
+		if err := s.client.Get(ctx, client.ObjectKey{Namespace: "dapr-system", Name: "dapr-trust-bundle"}, &secret); err != nil {
+			t.Fatal(err)
+		}
+
+		certs, err := pkcs12.DecodeTrustStore(secret.Data["truststore.p12"], password)
+		if err != nil {
+			t.Fatalf("failed to decode PKCS#12 truststore: %s", err)
+		}
+		var got []string
+		for _, cert := range certs {
+			got = append(got, fingerprint(cert))
+		}
+		if len(got) != len(expFingerprints) {
+			t.Errorf("unexpected PKCS#12 truststore certificates, exp=%v got=%v", expFingerprints, got)
+		}
+
+		ks := keystore.New()
+		if err := ks.Load(bytes.NewReader(secret.Data["truststore.jks"]), []byte(password)); err != nil {
+			t.Fatalf("failed to decode JKS truststore: %s", err)
+		}
+		for _, fp := range expFingerprints {
+			if !ks.IsTrustedCertificateEntry(fp) {
+				t.Errorf("expected JKS truststore to contain %s, got %v", fp, ks.Aliases())
+			}
+		}
+		if len(ks.Aliases()) != len(expFingerprints) {
+			t.Errorf("unexpected JKS truststore aliases, exp=%v got=%v", expFingerprints, ks.Aliases())
+		}
+
+		return secret
+	}
+
+	secret := expTruststores("changeit", fingerprint(root.cert))
+
+	// The truststores are not rendered again if the trust bundle is unchanged.
+	if again := expTruststores("changeit", fingerprint(root.cert)); again.ResourceVersion != secret.ResourceVersion {
+		t.Error("expected truststores to not be rewritten")
+	}
+
+	// The truststores are rendered again when the trust bundle changes.
+	secret.Data["ca.crt"] = append(certPEM(root.cert), certPEM(newRoot.cert)...)
+	if err := s.client.Update(ctx, &secret); err != nil {
+		t.Fatal(err)
+	}
+	expTruststores("changeit", fingerprint(root.cert), fingerprint(newRoot.cert))
+
+	// The truststores are rendered again when the password changes.
+	passwordSecret.Data["password"] = []byte("new-password")
+	if err := s.client.Update(ctx, passwordSecret); err != nil {
+		t.Fatal(err)
+	}
+	expTruststores("new-password", fingerprint(root.cert), fingerprint(newRoot.cert))
+}
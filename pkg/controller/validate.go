@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+)
+
+// validationError is returned when the issuer from cert-manager is not
+// appropriate to be used by dapr, and so must not be written to the dapr
+// trust-bundle Secret.
+type validationError struct {
+	err error
+}
+
+func (v *validationError) Error() string {
+	return fmt.Sprintf("issuer failed validation: %s", v.err)
+}
+
+func (v *validationError) Unwrap() error {
+	return v.err
+}
+
+// validateIssuer validates that the given issuer certificate chain and
+// private key can be used by dapr to issue workload certificates. The
+// private key must match the certificate, the certificate must be a currently
+// valid CA with the certSign key usage, and it must chain to at least one of
+// the trust anchors. If trustAnchors is nil, the chain is not checked.
+// All failed checks are returned as a validationError.
+func validateIssuer(certPEM, keyPEM []byte, trustAnchors *x509bundle.Bundle, now time.Time) error {
+	chain, err := parseCertificates(certPEM)
+	if err != nil {
+		return &validationError{err: fmt.Errorf("failed to parse issuer certificate: %w", err)}
+	}
+	issuer := chain[0]
+
+	var errs []error
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		errs = append(errs, fmt.Errorf("private key does not match issuer certificate: %w", err))
+	}
+
+	if !issuer.BasicConstraintsValid || !issuer.IsCA {
+		errs = append(errs, errors.New("issuer certificate is not a CA"))
+	}
+
+	if issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		errs = append(errs, errors.New("issuer certificate does not have the certSign key usage"))
+	}
+
+	if now.Before(issuer.NotBefore) {
+		errs = append(errs, fmt.Errorf("issuer certificate is not valid until %s", issuer.NotBefore.UTC().Format(time.RFC3339)))
+	}
+	if now.After(issuer.NotAfter) {
+		errs = append(errs, fmt.Errorf("issuer certificate expired at %s", issuer.NotAfter.UTC().Format(time.RFC3339)))
+	}
+
+	if trustAnchors != nil {
+		var chained bool
+		for _, anchor := range trustAnchors.X509Authorities() {
+			if chainsTo(chain, anchor) {
+				chained = true
+				break
+			}
+		}
+		if !chained {
+			errs = append(errs, errors.New("issuer certificate does not chain to any trust anchor in the trust bundle"))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &validationError{err: errors.Join(errs...)}
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+)
+
+func Test_validateIssuer(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*2))
+	otherRoot := genCA(t, "other-root", nil, now.Add(-time.Hour), now.Add(time.Hour*2))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour))
+	expiredIssuer := genCA(t, "expired-issuer", root, now.Add(-time.Hour*2), now.Add(-time.Hour))
+	leaf := genCert(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}, root)
+
+	bundle := func(certs ...*x509.Certificate) *x509bundle.Bundle {
+		return x509bundle.FromX509Authorities(spiffeid.TrustDomain{}, certs)
+	}
+
+	tests := map[string]struct {
+		cert         []byte
+		key          []byte
+		trustAnchors *x509bundle.Bundle
+		expErr       bool
+	}{
+		"valid issuer should not error": {
+			cert:         certPEM(issuer.cert),
+			key:          keyPEM(t, issuer.key),
+			trustAnchors: bundle(otherRoot.cert, root.cert),
+			expErr:       false,
+		},
+		"no trust anchors should not check chain": {
+			cert:         certPEM(issuer.cert),
+			key:          keyPEM(t, issuer.key),
+			trustAnchors: nil,
+			expErr:       false,
+		},
+		"invalid certificate should error": {
+			cert:         []byte("not a certificate"),
+			key:          keyPEM(t, issuer.key),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+		"mismatched private key should error": {
+			cert:         certPEM(issuer.cert),
+			key:          keyPEM(t, root.key),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+		"non-CA certificate should error": {
+			cert:         certPEM(leaf.cert),
+			key:          keyPEM(t, leaf.key),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+		"expired certificate should error": {
+			cert:         certPEM(expiredIssuer.cert),
+			key:          keyPEM(t, expiredIssuer.key),
+			trustAnchors: bundle(root.cert),
+			expErr:       true,
+		},
+		"certificate not chaining to trust anchors should error": {
+			cert:         certPEM(issuer.cert),
+			key:          keyPEM(t, issuer.key),
+			trustAnchors: bundle(otherRoot.cert),
+			expErr:       true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateIssuer(test.cert, test.key, test.trustAnchors, now)
+			if (err != nil) != test.expErr {
+				t.Fatalf("unexpected error, exp=%t got=%v", test.expErr, err)
+			}
+			var verr *validationError
+			if err != nil && !errors.As(err, &verr) {
+				t.Errorf("expected validationError, got=%T", err)
+			}
+		})
+	}
+}
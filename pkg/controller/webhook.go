@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/clock"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// WebhookPath is the path the trust bundle validating webhook is served
+	// on.
+	WebhookPath = "/validate-dapr-trust-bundle"
+)
+
+// WebhookOptions configure AddWebhook.
+type WebhookOptions struct {
+	Log logr.Logger
+
+	// Warn will allow destructive edits of the dapr trust-bundle Secret with
+	// a warning, rather than rejecting them.
+	Warn bool
+
+	// AllowedUsernames are the users whose edits are never validated, which
+	// should include dapr-cert-manager itself.
+	AllowedUsernames []string
+
+	// TrustBundle are the Options of the trust-bundle controller. Edits of the
+	// Secret keys it writes, including those of DaprCertificateBindings, are
+	// validated.
+	TrustBundle Options
+}
+
+// trustBundleValidator validates updates to the dapr Secrets made by other
+// principals, so that currently valid trust anchors are never removed and the
+// issuer always chains to the trust bundle.
+type trustBundleValidator struct {
+	log     logr.Logger
+	clock   clock.PassiveClock
+	decoder admission.Decoder
+	// secCtl resolves the secretConfs of the trust-bundle controller, whose
+	// target Secret keys are validated.
+	secCtl *secretCtrl
+
+	warn             bool
+	allowedUsernames []string
+}
+
+// AddWebhook registers the dapr trust-bundle Secret validating webhook with
+// the webhook server of the Manager.
+func AddWebhook(mgr ctrl.Manager, opts WebhookOptions) error {
+	secCtl, err := newSecretCtrl(opts.TrustBundle)
+	if err != nil {
+		return err
+	}
+	secCtl.lister = mgr.GetCache()
+	secCtl.secretReader = mgr.GetCache()
+
+	validator := &trustBundleValidator{
+		log:              opts.Log.WithName("webhook").WithName("trust-bundle"),
+		clock:            clock.RealClock{},
+		decoder:          admission.NewDecoder(mgr.GetScheme()),
+		secCtl:           secCtl,
+		warn:             opts.Warn,
+		allowedUsernames: opts.AllowedUsernames,
+	}
+
+	mgr.GetWebhookServer().Register(WebhookPath, &webhook.Admission{Handler: validator})
+
+	return nil
+}
+
+// Handle validates an update of a dapr Secret which is the target of any
+// secretConf.
+func (v *trustBundleValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation != admissionv1.Update || req.Kind.Kind != "Secret" {
+		return admission.Allowed("")
+	}
+	if slices.Contains(v.allowedUsernames, req.UserInfo.Username) {
+		return admission.Allowed("")
+	}
+
+	confs, err := v.targetConfs(ctx, req.Namespace, req.Name)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(confs) == 0 {
+		return admission.Allowed("")
+	}
+
+	var oldSecret, newSecret corev1.Secret
+	if err := v.decoder.DecodeRaw(req.OldObject, &oldSecret); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if err := v.decoder.DecodeRaw(req.Object, &newSecret); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var problems []string
+	for _, conf := range confs {
+		problems = append(problems, v.validate(ctx, conf, oldSecret, newSecret)...)
+	}
+	if len(problems) == 0 {
+		webhookDecisionsTotal.WithLabelValues(req.Namespace, req.Name, "allowed").Inc()
+		return admission.Allowed("")
+	}
+
+	log := v.log.WithValues("namespace", req.Namespace, "secret", req.Name, "user", req.UserInfo.Username)
+	if v.warn {
+		log.Info("allowing destructive edit of dapr Secret", "problems", problems)
+		webhookDecisionsTotal.WithLabelValues(req.Namespace, req.Name, "warned").Inc()
+		return admission.Allowed("").WithWarnings(problems...)
+	}
+
+	log.Info("rejecting destructive edit of dapr Secret", "problems", problems)
+	webhookDecisionsTotal.WithLabelValues(req.Namespace, req.Name, "denied").Inc()
+	return admission.Denied(fmt.Sprintf("dapr-cert-manager: %s", strings.Join(problems, "; ")))
+}
+
+// targetConfs returns the secretConfs which write to the Secret with the
+// given namespace and name. Returns nil if the namespace is not managed.
+func (v *trustBundleValidator) targetConfs(ctx context.Context, namespace, name string) ([]secretConf, error) {
+	if !v.secCtl.managesNamespace(ctx, namespace) {
+		return nil, nil
+	}
+
+	confs, err := v.secCtl.secretConfs(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(confs, func(conf secretConf) bool {
+		return conf.certSecretName != name && conf.caSecretName != name
+	}), nil
+}
+
+// validate returns the reasons the update from the old to the new dapr Secret
+// is destructive for the given secretConf. Returns nil if it is not.
+func (v *trustBundleValidator) validate(ctx context.Context, conf secretConf, oldSecret, newSecret corev1.Secret) []string {
+	now := v.clock.Now()
+
+	var problems []string
+	newTA := x509bundle.New(spiffeid.TrustDomain{})
+	if conf.caSecretName == newSecret.Name {
+		oldTA := x509bundle.New(spiffeid.TrustDomain{})
+		if len(oldSecret.Data[conf.certSecretCAKey]) > 0 {
+			// A current trust bundle which can't be parsed can't lose any trust
+			// anchors.
+			if bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, oldSecret.Data[conf.certSecretCAKey]); err == nil {
+				oldTA = bundle
+			}
+		}
+
+		if len(newSecret.Data[conf.certSecretCAKey]) > 0 {
+			bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, newSecret.Data[conf.certSecretCAKey])
+			if err != nil {
+				return []string{fmt.Sprintf("failed to parse trust bundle %q: %s", conf.certSecretCAKey, err)}
+			}
+			newTA = bundle
+		}
+
+		for _, cert := range oldTA.X509Authorities() {
+			if now.Before(cert.NotAfter) && !newTA.HasX509Authority(cert) {
+				problems = append(problems, fmt.Sprintf("removes currently valid trust anchor subject=%q sha256=%s from %q",
+					cert.Subject.String(), fingerprint(cert), conf.certSecretCAKey))
+			}
+		}
+	}
+
+	if conf.certSecretName != newSecret.Name || len(conf.caSecretName) == 0 {
+		return problems
+	}
+
+	certPEM, keyPEM := newSecret.Data[conf.certSectretKey], newSecret.Data[conf.certSecretPKKey]
+	if len(certPEM) == 0 || (bytes.Equal(certPEM, oldSecret.Data[conf.certSectretKey]) &&
+		bytes.Equal(keyPEM, oldSecret.Data[conf.certSecretPKKey])) {
+		return problems
+	}
+
+	if conf.caSecretName != newSecret.Name {
+		// The issuer must chain to the trust bundle of the separate dapr CA
+		// Secret.
+		var caSecret corev1.Secret
+		if err := v.secCtl.secretReader.Get(ctx, types.NamespacedName{Namespace: newSecret.Namespace, Name: conf.caSecretName}, &caSecret); err != nil {
+			return append(problems, fmt.Sprintf("failed to read dapr CA Secret %q: %s", conf.caSecretName, err))
+		}
+		bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, caSecret.Data[conf.certSecretCAKey])
+		if err != nil {
+			return append(problems, fmt.Sprintf("failed to parse trust bundle %q of dapr CA Secret %q: %s", conf.certSecretCAKey, conf.caSecretName, err))
+		}
+		newTA = bundle
+	}
+
+	if err := validateIssuer(certPEM, keyPEM, newTA, now); err != nil {
+		problems = append(problems, fmt.Sprintf("sets an invalid issuer %q: %s", conf.certSectretKey, err))
+	}
+
+	return problems
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func Test_trustBundleValidator(t *testing.T) {
+	now := time.Now()
+	root := genCA(t, "root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	newRoot := genCA(t, "new-root", nil, now.Add(-time.Hour), now.Add(time.Hour*48))
+	expiredRoot := genCA(t, "expired-root", nil, now.Add(-time.Hour*48), now.Add(-time.Hour))
+	issuer := genCA(t, "issuer", root, now.Add(-time.Hour), now.Add(time.Hour*47))
+	newIssuer := genCA(t, "new-issuer", newRoot, now.Add(-time.Hour), now.Add(time.Hour*47))
+
+	current := map[string][]byte{
+		"issuer.crt": certPEM(issuer.cert),
+		"issuer.key": keyPEM(t, issuer.key),
+		"ca.crt":     append(certPEM(root.cert), certPEM(expiredRoot.cert)...),
+	}
+
+	appCurrent := map[string][]byte{
+		"tls.crt": certPEM(newIssuer.cert),
+		"tls.key": keyPEM(t, newIssuer.key),
+	}
+
+	tests := map[string]struct {
+		username   string
+		name       string
+		old        map[string][]byte
+		data       map[string][]byte
+		warn       bool
+		expAllowed bool
+		expWarning bool
+	}{
+		"adding a trust anchor is allowed": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     append(current["ca.crt"], certPEM(newRoot.cert)...),
+			},
+			expAllowed: true,
+		},
+		"removing an expired trust anchor is allowed": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(root.cert),
+			},
+			expAllowed: true,
+		},
+		"removing a valid trust anchor is denied": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(newRoot.cert),
+			},
+			expAllowed: false,
+		},
+		"removing a valid trust anchor is allowed with a warning in warn mode": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(issuer.cert),
+				"issuer.key": keyPEM(t, issuer.key),
+				"ca.crt":     certPEM(newRoot.cert),
+			},
+			warn:       true,
+			expAllowed: true,
+			expWarning: true,
+		},
+		"an issuer which does not chain to the trust bundle is denied": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(newIssuer.cert),
+				"issuer.key": keyPEM(t, newIssuer.key),
+				"ca.crt":     current["ca.crt"],
+			},
+			expAllowed: false,
+		},
+		"an issuer which chains to the trust bundle is allowed": {
+			data: map[string][]byte{
+				"issuer.crt": certPEM(newIssuer.cert),
+				"issuer.key": keyPEM(t, newIssuer.key),
+				"ca.crt":     append(current["ca.crt"], certPEM(newRoot.cert)...),
+			},
+			expAllowed: true,
+		},
+		"edits by allowed users are not validated": {
+			username:   "system:serviceaccount:cert-manager:dapr-cert-manager",
+			data:       map[string][]byte{},
+			expAllowed: true,
+		},
+		"other Secrets are not validated": {
+			name:       "other",
+			data:       map[string][]byte{},
+			expAllowed: true,
+		},
+		"removing a valid trust anchor from the CA Secret of a binding is denied": {
+			name:       "app-ca",
+			old:        map[string][]byte{"ca.crt": current["ca.crt"]},
+			data:       map[string][]byte{"ca.crt": certPEM(newRoot.cert)},
+			expAllowed: false,
+		},
+		"a binding issuer which does not chain to the binding CA Secret is denied": {
+			name: "app-secret",
+			old:  map[string][]byte{},
+			data: appCurrent,
+		},
+		"a binding issuer which chains to the binding CA Secret is allowed": {
+			name: "app-secret",
+			old:  appCurrent,
+			data: map[string][]byte{
+				"tls.crt": certPEM(issuer.cert),
+				"tls.key": keyPEM(t, issuer.key),
+			},
+			expAllowed: true,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	appCA := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: "app-ca"},
+		Data:       map[string][]byte{"ca.crt": current["ca.crt"]},
+	}
+	cl := fake.NewClientBuilder().WithScheme(scheme).WithObjects(appCA).Build()
+	secCtl := &secretCtrl{
+		lister:         cl,
+		secretReader:   cl,
+		daprNamespaces: map[string]struct{}{"dapr-system": {}},
+		confs: []secretConf{testSecretConf, {
+			certName:        "app",
+			certSecretName:  "app-secret",
+			caSecretName:    "app-ca",
+			certSectretKey:  "tls.crt",
+			certSecretPKKey: "tls.key",
+			certSecretCAKey: "ca.crt",
+		}},
+	}
+
+	raw := func(name string, data map[string][]byte) runtime.RawExtension {
+		b, err := json.Marshal(&corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Namespace: "dapr-system", Name: name},
+			Data:       data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runtime.RawExtension{Raw: b}
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := &trustBundleValidator{
+				log:              logr.Discard(),
+				clock:            clocktesting.NewFakePassiveClock(now),
+				decoder:          admission.NewDecoder(scheme),
+				secCtl:           secCtl,
+				warn:             test.warn,
+				allowedUsernames: []string{"system:serviceaccount:cert-manager:dapr-cert-manager"},
+			}
+
+			secretName := "dapr-trust-bundle"
+			if len(test.name) > 0 {
+				secretName = test.name
+			}
+			old := current
+			if test.old != nil {
+				old = test.old
+			}
+			username := "helm"
+			if len(test.username) > 0 {
+				username = test.username
+			}
+
+			resp := v.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Update,
+				Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Secret"},
+				Namespace: "dapr-system",
+				Name:      secretName,
+				UserInfo:  authenticationv1.UserInfo{Username: username},
+				OldObject: raw(secretName, old),
+				Object:    raw(secretName, test.data),
+			}})
+
+			if resp.Allowed != test.expAllowed {
+				t.Errorf("expected allowed=%t, got %t: %v", test.expAllowed, resp.Allowed, resp.Result)
+			}
+			if (len(resp.Warnings) > 0) != test.expWarning {
+				t.Errorf("expected warning=%t, got %v", test.expWarning, resp.Warnings)
+			}
+		})
+	}
+}
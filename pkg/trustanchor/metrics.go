@@ -0,0 +1,20 @@
+package trustanchor
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// sourceDegraded is set to 1 while the trust anchors of a source fail to
+	// reload, and the last known good trust anchors are being served.
+	sourceDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "dapr_cert_manager",
+		Name:      "trust_anchor_source_degraded",
+		Help:      "Whether the trust anchor source failed to reload, and the last known good trust anchors are being served.",
+	}, []string{"source"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(sourceDegraded)
+}
@@ -0,0 +1,168 @@
+package trustanchor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+const (
+	// KindConfigMap sources the trust anchors from a key of a ConfigMap, for
+	// example the target of a trust-manager Bundle.
+	KindConfigMap = "ConfigMap"
+
+	// KindSecret sources the trust anchors from a key of a Secret.
+	KindSecret = "Secret"
+)
+
+type ObjectOptions struct {
+	Log logr.Logger
+
+	// Client is used to watch the object.
+	Client kubernetes.Interface
+
+	// Kind is the kind of the object containing the trust bundle, either
+	// ConfigMap or Secret.
+	Kind string
+
+	// Namespace is the namespace of the object.
+	Namespace string
+
+	// Name is the name of the object.
+	Name string
+
+	// Key is the key of the object's data containing the PEM encoded trust
+	// bundle.
+	Key string
+}
+
+// object is a trust anchor source which watches a key of a ConfigMap or
+// Secret.
+type object struct {
+	*internal
+	client    kubernetes.Interface
+	kind      string
+	namespace string
+	name      string
+	key       string
+}
+
+// NewObject returns a trust anchor source which is sourced from a key of a
+// ConfigMap or Secret. Only the single object is watched.
+func NewObject(opts ObjectOptions) Interface {
+	log := opts.Log.WithName("trustanchor").WithValues("kind", opts.Kind, "namespace", opts.Namespace, "name", opts.Name, "key", opts.Key)
+	return &object{
+		internal: &internal{
+			log:    log,
+			source: fmt.Sprintf("%s %s/%s key %q", opts.Kind, opts.Namespace, opts.Name, opts.Key),
+		},
+		client:    opts.Client,
+		kind:      opts.Kind,
+		namespace: opts.Namespace,
+		name:      opts.Name,
+		key:       opts.Key,
+	}
+}
+
+func (o *object) Start(ctx context.Context) error {
+	o.log.Info("starting trust anchor manager")
+
+	var (
+		listWatch *toolscache.ListWatch
+		objType   runtime.Object
+	)
+	selector := fields.OneTermEqualSelector("metadata.name", o.name).String()
+	switch o.kind {
+	case KindConfigMap:
+		objType = new(corev1.ConfigMap)
+		listWatch = &toolscache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				opts.FieldSelector = selector
+				return o.client.CoreV1().ConfigMaps(o.namespace).List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				opts.FieldSelector = selector
+				return o.client.CoreV1().ConfigMaps(o.namespace).Watch(ctx, opts)
+			},
+		}
+	case KindSecret:
+		objType = new(corev1.Secret)
+		listWatch = &toolscache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				opts.FieldSelector = selector
+				return o.client.CoreV1().Secrets(o.namespace).List(ctx, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				opts.FieldSelector = selector
+				return o.client.CoreV1().Secrets(o.namespace).Watch(ctx, opts)
+			},
+		}
+	default:
+		return fmt.Errorf("unsupported trust anchor object kind %q", o.kind)
+	}
+
+	informer := toolscache.NewSharedInformer(listWatch, objType, 0)
+	if _, err := informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { o.handle(ctx, obj) },
+		UpdateFunc: func(_, obj any) { o.handle(ctx, obj) },
+		DeleteFunc: func(any) {
+			// Never remove trust anchors because the object was deleted, since
+			// this would break trust for every dapr sidecar.
+			o.log.Error(nil, "trust anchor object was deleted, keeping the last known trust anchors")
+			o.setReloadErr(fmt.Errorf("%s %s/%s was deleted", o.kind, o.namespace, o.name))
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add trust anchor event handler: %w", err)
+	}
+
+	informer.Run(ctx.Done())
+	o.log.Info("stopping trust anchor manager")
+
+	return nil
+}
+
+// handle updates the trust bundle from the given ConfigMap or Secret. The
+// bundle is left unchanged if the object contains no valid trust anchors.
+func (o *object) handle(ctx context.Context, obj any) {
+	var data []byte
+	switch obj := obj.(type) {
+	case *corev1.ConfigMap:
+		if value, ok := obj.Data[o.key]; ok {
+			data = []byte(value)
+		} else {
+			data = obj.BinaryData[o.key]
+		}
+	case *corev1.Secret:
+		data = obj.Data[o.key]
+	default:
+		return
+	}
+
+	bundle, err := x509bundle.Parse(spiffeid.TrustDomain{}, data)
+	if err != nil {
+		o.log.Error(err, "failed to parse trust anchors, keeping the last known trust anchors")
+		o.setReloadErr(err)
+		return
+	}
+	o.setReloadErr(nil)
+
+	o.lock.RLock()
+	unchanged := o.bundle != nil && o.bundle.Equal(bundle)
+	o.lock.RUnlock()
+	if unchanged {
+		return
+	}
+
+	o.log.Info("trust anchors updated", "count", len(bundle.X509Authorities()))
+	o.updateBundle(ctx, bundle)
+}
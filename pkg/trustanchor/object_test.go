@@ -0,0 +1,138 @@
+package trustanchor
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/klog/v2/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// genRootPEM returns a PEM encoded self-signed root CA certificate.
+func genRootPEM(t *testing.T, cn string) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func Test_object_runnable(t *testing.T) {
+	var _ manager.LeaderElectionRunnable = NewObject(ObjectOptions{Log: klogr.New()})
+}
+
+func Test_object(t *testing.T) {
+	root1, root2 := genRootPEM(t, "root-1"), genRootPEM(t, "root-2")
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cert-manager", Name: "dapr-roots"},
+		Data:       map[string]string{"ca.crt": string(root1)},
+	}
+	cl := fake.NewSimpleClientset(cm)
+
+	ta := NewObject(ObjectOptions{
+		Log:       klogr.New(),
+		Client:    cl,
+		Kind:      KindConfigMap,
+		Namespace: "cert-manager",
+		Name:      "dapr-roots",
+		Key:       "ca.crt",
+	})
+	eventCh := ta.EventChannel()
+
+	series := testutil.CollectAndCount(sourceDegraded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- ta.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Error(err)
+		}
+	})
+
+	expAnchors := func(exp int) {
+		t.Helper()
+		select {
+		case <-eventCh:
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for trust anchor event")
+		}
+		bundle, err := ta.GetX509BundleForTrustDomain(spiffeid.TrustDomain{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(bundle.X509Authorities()); n != exp {
+			t.Errorf("expected %d trust anchors, got %d", exp, n)
+		}
+	}
+
+	expAnchors(1)
+	// The source is reported healthy from the first load.
+	if n := testutil.CollectAndCount(sourceDegraded); n != series+1 {
+		t.Errorf("expected degraded metric to be set after the first load, got %d series", n-series)
+	}
+	if v := testutil.ToFloat64(sourceDegraded.WithLabelValues(ta.(*object).source)); v != 0 {
+		t.Errorf("expected degraded metric to be 0, got %v", v)
+	}
+
+	cm.Data["ca.crt"] = string(root1) + string(root2)
+	if _, err := cl.CoreV1().ConfigMaps("cert-manager").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expAnchors(2)
+
+	// Invalid data or deleting the ConfigMap should keep the last known trust
+	// anchors.
+	cm.Data["ca.crt"] = "invalid"
+	if _, err := cl.CoreV1().ConfigMaps("cert-manager").Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.CoreV1().ConfigMaps("cert-manager").Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-eventCh:
+		t.Error("unexpected trust anchor event")
+	case <-time.After(time.Millisecond * 200):
+	}
+	bundle, err := ta.GetX509BundleForTrustDomain(spiffeid.TrustDomain{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(bundle.X509Authorities()); n != 2 {
+		t.Errorf("expected 2 trust anchors to be kept, got %d", n)
+	}
+	if err := ta.Ready(nil); err == nil {
+		t.Error("expected trust anchor source to not be ready")
+	}
+}
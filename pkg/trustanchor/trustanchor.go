@@ -2,10 +2,16 @@ package trustanchor
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/dapr/kit/fswatcher"
 	"github.com/go-logr/logr"
@@ -18,50 +24,93 @@ import (
 type Options struct {
 	Log logr.Logger
 
-	// TrustBundlePath is the path to the trust bundle file.
-	TrustBundlePath string
+	// TrustBundlePaths are the paths to the trust bundle files. A path may be
+	// a directory, in which case every PEM file in the directory is loaded.
+	// All trust anchors are merged into a single bundle.
+	TrustBundlePaths []string
+
+	// DebounceInterval is the interval in which bursts of file events are
+	// batched into a single reload. Defaults to 500ms.
+	DebounceInterval time.Duration
 }
 
+const (
+	// defaultDebounceInterval is the default interval in which bursts of file
+	// events are batched into a single reload.
+	defaultDebounceInterval = 500 * time.Millisecond
+
+	// retryInitialInterval and retryMaxInterval bound the exponential backoff
+	// of reloads which failed.
+	retryInitialInterval = time.Second
+	retryMaxInterval     = time.Minute
+)
+
 type Interface interface {
 	x509bundle.Source
 	manager.LeaderElectionRunnable
 	manager.Runnable
 	EventChannel() <-chan event.GenericEvent
+
+	// Ready returns an error if the trust anchors have not been loaded, or if
+	// the last reload failed and the last known good trust anchors are being
+	// served. It is used as a readiness check.
+	Ready(*http.Request) error
 }
 
 type internal struct {
 	log    logr.Logger
-	path   string
+	paths  []string
+	source string
 	bundle *x509bundle.Bundle
-	lock   sync.RWMutex
-	env    []chan<- event.GenericEvent
-	wg     sync.WaitGroup
+	// reloadErr is the error of the last failed reload. Nil if the last
+	// reload succeeded.
+	reloadErr error
+	lock      sync.RWMutex
+	env       []chan<- event.GenericEvent
+	wg        sync.WaitGroup
+
+	debounce     time.Duration
+	retryInitial time.Duration
+	retryMax     time.Duration
 }
 
 func New(ops Options) Interface {
+	debounce := ops.DebounceInterval
+	if debounce <= 0 {
+		debounce = defaultDebounceInterval
+	}
+
 	return &internal{
-		log:  ops.Log.WithName("trustanchor"),
-		path: ops.TrustBundlePath,
+		log:          ops.Log.WithName("trustanchor"),
+		paths:        ops.TrustBundlePaths,
+		source:       fmt.Sprintf("files %q", ops.TrustBundlePaths),
+		debounce:     debounce,
+		retryInitial: retryInitialInterval,
+		retryMax:     retryMaxInterval,
 	}
 }
 
 func (i *internal) Start(ctx context.Context) error {
-	defer i.wg.Done()
+	defer i.wg.Wait()
 	i.log.Info("starting trust anchor manager")
 
-	// Load the trust bundle from the file.
-	bundle, err := x509bundle.Load(spiffeid.TrustDomain{}, i.path)
+	// Load the trust bundle from the files.
+	bundle, err := Load(i.paths...)
 	if err != nil {
-		return fmt.Errorf("failed to load trust bundle from file %q: %w", i.path, err)
+		return fmt.Errorf("failed to load trust bundle from files %q: %w", i.paths, err)
 	}
 
 	fs, err := fswatcher.New(fswatcher.Options{
-		Targets: []string{filepath.Dir(i.path)},
+		Targets:  watchTargets(i.paths),
+		Interval: &i.debounce,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
+	// Report the source as healthy from the first load, rather than only once
+	// a reload has succeeded.
+	i.setReloadErr(nil)
 	i.updateBundle(ctx, bundle)
 
 	errCh := make(chan error)
@@ -79,19 +128,46 @@ func (i *internal) Start(ctx context.Context) error {
 		errCh <- err
 	}()
 
+	// A failed reload keeps the last known good trust anchors, and is retried
+	// with exponential backoff until it succeeds or the files change again.
+	var (
+		retry   *time.Timer
+		retryCh <-chan time.Time
+		backoff = i.retryInitial
+	)
+	defer func() {
+		if retry != nil {
+			retry.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
 			i.log.Info("stopping trust anchor manager")
 			return <-errCh
 		case <-eventCh:
-			bundle, err := x509bundle.Load(spiffeid.TrustDomain{}, i.path)
-			if err != nil {
-				cancel()
-				return errors.Join(err, <-errCh)
-			}
-			i.updateBundle(ctx, bundle)
+		case <-retryCh:
+		}
+
+		if retry != nil {
+			retry.Stop()
+			retryCh = nil
 		}
+
+		bundle, err := Load(i.paths...)
+		if err != nil {
+			i.log.Error(err, "failed to reload trust anchors, keeping the last known good trust anchors", "retry", backoff)
+			i.setReloadErr(err)
+			retry = time.NewTimer(backoff)
+			retryCh = retry.C
+			backoff = min(backoff*2, i.retryMax)
+			continue
+		}
+
+		backoff = i.retryInitial
+		i.setReloadErr(nil)
+		i.updateBundle(ctx, bundle)
 	}
 }
 
@@ -125,13 +201,155 @@ func (i *internal) EventChannel() <-chan event.GenericEvent {
 	return env
 }
 
+func (i *internal) Ready(*http.Request) error {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	if i.bundle == nil {
+		return fmt.Errorf("trust bundle is not yet loaded from %s", i.source)
+	}
+	if i.reloadErr != nil {
+		return fmt.Errorf("failed to reload trust bundle from %s: %w", i.source, i.reloadErr)
+	}
+
+	return nil
+}
+
+// setReloadErr records the result of the last reload of the trust anchors.
+func (i *internal) setReloadErr(err error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.reloadErr = err
+
+	var degraded float64
+	if err != nil {
+		degraded = 1
+	}
+	sourceDegraded.WithLabelValues(i.source).Set(degraded)
+}
+
 func (i *internal) GetX509BundleForTrustDomain(_ spiffeid.TrustDomain) (*x509bundle.Bundle, error) {
 	i.lock.RLock()
 	defer i.lock.RUnlock()
 
 	if i.bundle == nil {
-		return nil, fmt.Errorf("trust bundle is not yet loaded from file %q", i.path)
+		return nil, fmt.Errorf("trust bundle is not yet loaded from %s", i.source)
 	}
 
 	return i.bundle, nil
 }
+
+// Load loads and merges the trust anchors from the PEM files at the given
+// paths. A path may be a directory, in which case every file in the directory
+// containing PEM certificates is loaded. Hidden files, such as the `..data`
+// entries of projected volumes, and sub-directories are ignored.
+func Load(paths ...string) (*x509bundle.Bundle, error) {
+	bundle := x509bundle.New(spiffeid.TrustDomain{})
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			certs, err := loadCertificates(path)
+			if err != nil {
+				return nil, err
+			}
+			if len(certs) == 0 {
+				return nil, fmt.Errorf("no certificates found in file %q", path)
+			}
+			addX509Authorities(bundle, certs)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+
+			// Follow symlinks, which projected volumes use for every file.
+			file := filepath.Join(path, entry.Name())
+			info, err := os.Stat(file)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				continue
+			}
+
+			certs, err := loadCertificates(file)
+			if err != nil {
+				return nil, err
+			}
+			addX509Authorities(bundle, certs)
+		}
+	}
+
+	if bundle.Empty() {
+		return nil, fmt.Errorf("no certificates found in %q", paths)
+	}
+
+	return bundle, nil
+}
+
+// loadCertificates returns all PEM encoded certificates in the given file.
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate in file %q: %w", path, err)
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// addX509Authorities adds the given certificates to the bundle, skipping
+// those already present.
+func addX509Authorities(bundle *x509bundle.Bundle, certs []*x509.Certificate) {
+	for _, cert := range certs {
+		if !bundle.HasX509Authority(cert) {
+			bundle.AddX509Authority(cert)
+		}
+	}
+}
+
+// watchTargets returns the directories to watch for changes of the given
+// paths. Files are watched through their parent directory so that atomic
+// writes and symlink swaps are observed.
+func watchTargets(paths []string) []string {
+	var targets []string
+	seen := make(map[string]struct{})
+	for _, path := range paths {
+		target := path
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			target = filepath.Dir(path)
+		}
+		if _, ok := seen[target]; !ok {
+			seen[target] = struct{}{}
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
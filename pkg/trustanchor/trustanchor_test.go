@@ -1,9 +1,16 @@
 package trustanchor
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/spiffe/go-spiffe/v2/bundle/x509bundle"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
 	"k8s.io/klog/v2/klogr"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
@@ -12,3 +19,179 @@ func Test_trustanchor_x509bundleSource(t *testing.T) {
 	var _ x509bundle.Source = New(Options{Log: klogr.New()})
 	var _ manager.LeaderElectionRunnable = New(Options{Log: klogr.New()})
 }
+
+func Test_Load(t *testing.T) {
+	root1, root2, root3 := genRootPEM(t, "root-1"), genRootPEM(t, "root-2"), genRootPEM(t, "root-3")
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rootsDir := filepath.Join(dir, "roots")
+	write("roots/root-1.crt", root1)
+	write("roots/root-2.crt", root2)
+	write("roots/README", []byte("not a certificate"))
+	write("roots/..data/root-1.crt", root1)
+	file := write("root-3.crt", root3)
+	empty := write("empty.crt", []byte("not a certificate"))
+
+	tests := map[string]struct {
+		paths    []string
+		expCount int
+		expErr   bool
+	}{
+		"single file should load": {
+			paths:    []string{file},
+			expCount: 1,
+		},
+		"directory should load all PEM files, ignoring hidden and non PEM files": {
+			paths:    []string{rootsDir},
+			expCount: 2,
+		},
+		"directory and file should be merged": {
+			paths:    []string{rootsDir, file},
+			expCount: 3,
+		},
+		"duplicate trust anchors should be merged": {
+			paths:    []string{file, file},
+			expCount: 1,
+		},
+		"file with no certificates should error": {
+			paths:  []string{empty},
+			expErr: true,
+		},
+		"missing file should error": {
+			paths:  []string{filepath.Join(dir, "missing.crt")},
+			expErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			bundle, err := Load(test.paths...)
+			if (err != nil) != test.expErr {
+				t.Fatalf("unexpected error, exp=%t got=%v", test.expErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if n := len(bundle.X509Authorities()); n != test.expCount {
+				t.Errorf("expected %d trust anchors, got %d", test.expCount, n)
+			}
+		})
+	}
+}
+
+func Test_watchTargets(t *testing.T) {
+	dir := t.TempDir()
+	targets := watchTargets([]string{
+		filepath.Join(dir, "a.crt"),
+		filepath.Join(dir, "b.crt"),
+		dir,
+		"/other/c.crt",
+	})
+	if exp := []string{dir, "/other"}; !reflect.DeepEqual(targets, exp) {
+		t.Errorf("unexpected watch targets, exp=%v got=%v", exp, targets)
+	}
+}
+
+func Test_reload(t *testing.T) {
+	root1, root2 := genRootPEM(t, "root-1"), genRootPEM(t, "root-2")
+
+	path := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(path, root1, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ta := New(Options{
+		Log:              klogr.New(),
+		TrustBundlePaths: []string{path},
+		DebounceInterval: time.Millisecond * 10,
+	}).(*internal)
+	ta.retryInitial = time.Millisecond * 10
+	ta.retryMax = time.Millisecond * 50
+	eventCh := ta.EventChannel()
+
+	series := testutil.CollectAndCount(sourceDegraded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() { errCh <- ta.Start(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil {
+			t.Error(err)
+		}
+	})
+
+	expAnchors := func(exp int) {
+		t.Helper()
+		bundle, err := ta.GetX509BundleForTrustDomain(spiffeid.TrustDomain{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := len(bundle.X509Authorities()); n != exp {
+			t.Errorf("expected %d trust anchors, got %d", exp, n)
+		}
+	}
+	expEvent := func() {
+		t.Helper()
+		select {
+		case <-eventCh:
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for trust anchor event")
+		}
+	}
+
+	expEvent()
+	expAnchors(1)
+	if err := ta.Ready(nil); err != nil {
+		t.Errorf("expected ready, got %v", err)
+	}
+	// The source is reported healthy from the first load.
+	if n := testutil.CollectAndCount(sourceDegraded); n != series+1 {
+		t.Errorf("expected degraded metric to be set after the first load, got %d series", n-series)
+	}
+	if v := testutil.ToFloat64(sourceDegraded.WithLabelValues(ta.source)); v != 0 {
+		t.Errorf("expected degraded metric to be 0, got %v", v)
+	}
+
+	// A half written file should keep the last known good trust anchors, and
+	// report the source as degraded.
+	if err := os.WriteFile(path, []byte("-----BEGIN CERT"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for ta.Ready(nil) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for trust anchor source to be degraded")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	expAnchors(1)
+	if v := testutil.ToFloat64(sourceDegraded.WithLabelValues(ta.source)); v != 1 {
+		t.Errorf("expected degraded metric to be 1, got %v", v)
+	}
+
+	// Fixing the file recovers the source.
+	if err := os.WriteFile(path, append(root1, root2...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	expEvent()
+	expAnchors(2)
+	if err := ta.Ready(nil); err != nil {
+		t.Errorf("expected ready, got %v", err)
+	}
+	if v := testutil.ToFloat64(sourceDegraded.WithLabelValues(ta.source)); v != 0 {
+		t.Errorf("expected degraded metric to be 0, got %v", v)
+	}
+}